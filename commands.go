@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+	"github.com/playboy-Mr-Li/HerCode/lsp"
+	"github.com/playboy-Mr-Li/HerCode/readfile"
+	"github.com/playboy-Mr-Li/HerCode/repl"
+)
+
+// ==================== 子命令 ====================
+// 每个子命令返回进程的退出码，见 main.go 中的 exitOK 等常量
+
+// hercode run：运行脚本、字节码文件或 -e 给出的代码
+func run() int {
+	if F.FileName == "" && F.Code == "" {
+		fmt.Fprintf(os.Stderr, text.noInput, "run")
+		return exitUsage
+	}
+	interpreter := newInterpreter(os.Stdin)
+
+	if F.Verbose {
+		fmt.Fprintln(os.Stderr, "Her Code is Compiling...")
+	}
+	if code, errText := load(interpreter, F.FileName); code != exitOK {
+		fmt.Fprint(os.Stderr, errText)
+		return code
+	}
+
+	if F.Debug {
+		fmt.Println("Her Code is Debugging...")
+		// 打印解析结果
+		interpreter.PrintFunctions()
+		if interpreter.UseVM {
+			prog, err := interpreter.Program()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, text.compileErr, err)
+				return exitParse
+			}
+			fmt.Println(text.bytecode)
+			prog.Disassemble(os.Stdout)
+		}
+	}
+
+	// 执行程序
+	if F.Verbose {
+		fmt.Fprintln(os.Stderr, "Her Code is Running...")
+	}
+	ctx := context.Background()
+	if F.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, F.Timeout)
+		defer cancel()
+	}
+	// 按语句的顺序输出错误。脚本调用 exit 时以它给出的退出码结束，
+	// 但之前出过错时退出码至少为 exitRuntime，exit(0) 不会掩盖错误
+	status := exitOK
+	vals, errs := interpreter.Execute(ctx)
+	if interpreter.PrintedErrors() > 0 {
+		status = exitRuntime // say 输出的错误不中断执行，但同样算运行错误
+	}
+	for i, err := range errs {
+		if i < len(vals) && vals[i].Error != nil {
+			fmt.Fprintf(os.Stderr, text.runErr, vals[i].Error)
+			status = exitRuntime
+		}
+		var exit *hercodeinterpreter.ExitError
+		if errors.As(err, &exit) {
+			return max(status, exit.Code)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, text.runErr, err)
+			status = exitRuntime
+		}
+	}
+	return status
+}
+
+// 读取并解析脚本，字节码文件直接载入。出错时返回退出码和要输出的错误信息
+func load(interpreter *hercodeinterpreter.HerCodeInterpreter, name string) (int, string) {
+	if F.Code != "" {
+		if err := interpreter.ParseSnippet(F.Code); err != nil {
+			return exitParse, fmt.Sprintf(text.parseErr, err)
+		}
+		return exitOK, ""
+	}
+
+	b, err := readfile.ReadFile(name)
+	if err != nil {
+		return exitUsage, fmt.Sprintf(text.readErr, err)
+	}
+	if readfile.IsBytecode(name) {
+		prog, err := hercodeinterpreter.DecodeProgram(b)
+		if err != nil {
+			return exitUsage, fmt.Sprintf(text.loadErr, fmt.Sprintf("%s: %v", name, err))
+		}
+		if err := interpreter.LoadProgram(prog); err != nil {
+			return exitUsage, fmt.Sprintf(text.loadErr, err)
+		}
+	} else if err := interpreter.Parse(string(b)); err != nil {
+		return exitParse, fmt.Sprintf(text.parseErr, err)
+	}
+	return exitOK, ""
+}
+
+// 子命令要处理的脚本：-e 给出的代码或命令行中的文件
+func inputs(command string) ([]string, bool) {
+	if F.Code != "" {
+		return []string{"-e"}, true
+	}
+	if len(F.Files) == 0 {
+		fmt.Fprintf(os.Stderr, text.noInput, command)
+		return nil, false
+	}
+	return F.Files, true
+}
+
+// 读取 fmt、lint 等命令要处理的源代码：-e 给出的代码或脚本文件。出错时输出错误信息并返回退出码
+func source(name string) (string, int) {
+	if F.Code != "" {
+		return F.Code, exitOK
+	}
+	if readfile.IsBytecode(name) {
+		fmt.Fprintf(os.Stderr, text.isBytecode, name)
+		return "", exitUsage
+	}
+	b, err := readfile.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, text.readErr, err)
+		return "", exitUsage
+	}
+	return string(b), exitOK
+}
+
+// hercode check：只解析脚本、检查名字，不运行。每行错误前加上文件名，方便编辑器跳转
+func check() int {
+	names, ok := inputs("check")
+	if !ok {
+		return exitUsage
+	}
+	status := exitOK
+	for _, name := range names {
+		code, errText := load(newInterpreter(os.Stdin), name)
+		if code == exitOK {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(errText, "\n"), "\n") {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, line)
+		}
+		status = max(status, code)
+	}
+	return status
+}
+
+// hercode fmt：输出格式化后的脚本。
+// --check 只列出需要格式化的文件，有这样的文件时退出码为 exitRuntime；--write 把结果写回文件
+func format() int {
+	names, ok := inputs("fmt")
+	if !ok {
+		return exitUsage
+	}
+	if F.Write && (F.Code != "" || slices.Contains(names, "-")) {
+		fmt.Fprint(os.Stderr, text.fmtStdin)
+		return exitUsage
+	}
+	status := exitOK
+	for _, name := range names {
+		src, code := source(name)
+		if code != exitOK {
+			status = max(status, code)
+			continue
+		}
+		out, err := newInterpreter(os.Stdin).Format(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: "+text.parseErr, name, err)
+			status = max(status, exitParse)
+			continue
+		}
+		switch {
+		case F.Check:
+			if out != src {
+				fmt.Println(name)
+				status = max(status, exitRuntime)
+			}
+		case F.Write:
+			if out == src {
+				continue
+			}
+			if err := os.WriteFile(name, []byte(out), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, text.writeErr, name, err)
+				status = max(status, exitUsage)
+			}
+		default:
+			fmt.Print(out)
+		}
+	}
+	return status
+}
+
+// hercode lint：静态检查，每个问题一行：文件名:行号: 严重程度: 解释 [规则]。
+// 有错误或警告时退出码为 exitRuntime，只有提示时为 exitOK
+func lint() int {
+	names, ok := inputs("lint")
+	if !ok {
+		return exitUsage
+	}
+	status := exitOK
+	for _, name := range names {
+		src, code := source(name)
+		if code != exitOK {
+			status = max(status, code)
+			continue
+		}
+		diags, err := newInterpreter(os.Stdin).Lint(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, text.loadErr, err)
+			status = max(status, exitUsage)
+			continue
+		}
+		for _, d := range diags {
+			if F.Code != "" && d.Rule == hercodeinterpreter.RuleOutsideFunction {
+				continue // -e 给出的代码可以省略 start:
+			}
+			fmt.Printf("%s:%d: %s: %s [%s]\n", name, d.Line, text.severity[d.Severity], d.Msg, d.Rule)
+			if d.Severity != hercodeinterpreter.SeverityInfo {
+				status = max(status, exitRuntime)
+			}
+		}
+	}
+	return status
+}
+
+// hercode ast：输出解析得到的语法树
+func ast() int {
+	names, ok := inputs("ast")
+	if !ok {
+		return exitUsage
+	}
+	status := exitOK
+	for i, name := range names {
+		interpreter := newInterpreter(os.Stdin)
+		if code, errText := load(interpreter, name); code != exitOK {
+			fmt.Fprint(os.Stderr, errText)
+			status = max(status, code)
+			continue
+		}
+		if len(names) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n", name)
+		}
+		interpreter.WriteAST(os.Stdout)
+	}
+	return status
+}
+
+// hercode test：运行测试文件（*_test.hc）中名字以 test 开头、没有参数的函数。
+// 测试函数返回错误（例如 assert 失败）时测试失败；start 不会运行
+func test() int {
+	files, err := testFiles(F.Files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, text.readErr, err)
+		return exitUsage
+	}
+	if len(files) == 0 {
+		fmt.Println(text.noTests)
+		return exitOK
+	}
+
+	status, passed, failed := exitOK, 0, 0
+	for _, file := range files {
+		interpreter := newInterpreter(os.Stdin)
+		if code, errText := load(interpreter, file); code != exitOK {
+			fmt.Fprintf(os.Stderr, "%s: %s", file, errText)
+			status = max(status, code)
+			continue
+		}
+
+		var tests []*hercodeinterpreter.HerCodeFunction
+		for name, fn := range interpreter.GlobalCtx.Functions {
+			if strings.HasPrefix(name, "test") && len(fn.Parameters) == 0 {
+				tests = append(tests, fn)
+			}
+		}
+		sort.Slice(tests, func(i, j int) bool { return tests[i].Line < tests[j].Line })
+
+		for _, fn := range tests {
+			ctx := context.Background()
+			cancel := func() {}
+			if F.Timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, F.Timeout)
+			}
+			_, err := interpreter.Call(ctx, fn.Name)
+			cancel()
+			if err != nil {
+				fmt.Printf(text.testFail, file, fn.Name, err)
+				failed++
+				continue
+			}
+			if F.Verbose {
+				fmt.Printf(text.testPass, file, fn.Name)
+			}
+			passed++
+		}
+	}
+	fmt.Printf(text.testSummary, passed, failed)
+	if failed > 0 {
+		status = max(status, exitRuntime)
+	}
+	return status
+}
+
+// 测试文件：命令行中的文件，以及目录（默认为当前目录）下所有的 *_test.hc
+func testFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, "_test.hc") {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// hercode build：把脚本编译成字节码文件
+func build() int {
+	if F.FileName == "" {
+		fmt.Fprintf(os.Stderr, text.noFile, "build")
+		return exitUsage
+	}
+	if readfile.IsBytecode(F.FileName) {
+		fmt.Fprintf(os.Stderr, text.isBytecode, F.FileName)
+		return exitUsage
+	}
+	interpreter := newInterpreter(os.Stdin)
+	if code, errText := load(interpreter, F.FileName); code != exitOK {
+		fmt.Fprint(os.Stderr, errText)
+		return code
+	}
+
+	prog, err := interpreter.Program()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, text.compileErr, err)
+		return exitParse
+	}
+	out := F.Output
+	if out == "" {
+		out = strings.TrimSuffix(F.FileName, ".hc") + ".hcb"
+	}
+	if err := os.WriteFile(out, hercodeinterpreter.EncodeProgram(prog), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, text.writeErr, out, err)
+		return exitUsage
+	}
+	if F.Verbose {
+		fmt.Fprintf(os.Stderr, text.built, out)
+	}
+	return exitOK
+}
+
+// hercode repl：进入交互模式，输入历史保存在 ~/.hercode_history
+func startRepl() int {
+	cfg := repl.Config{New: newInterpreter, In: os.Stdin, Out: os.Stdout}
+	if home, err := os.UserHomeDir(); err == nil {
+		cfg.HistoryFile = filepath.Join(home, ".hercode_history")
+	}
+	if err := repl.Run(cfg); err != nil {
+		var exit *hercodeinterpreter.ExitError
+		if errors.As(err, &exit) {
+			return exit.Code
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+	return exitOK
+}
+
+// hercode lsp：语言服务器，通过标准输入输出与编辑器通信。
+// 标准输出只用来发送协议消息，解释器的输出都被丢弃
+func serveLSP() int {
+	cfg := lsp.Config{
+		New: func() *hercodeinterpreter.HerCodeInterpreter {
+			return hercodeinterpreter.NewHerCodeInterpreter(
+				hercodeinterpreter.WithLanguagePacks(packs...),
+				hercodeinterpreter.WithStdout(io.Discard),
+				hercodeinterpreter.WithStderr(io.Discard),
+				hercodeinterpreter.WithStdin(strings.NewReader("")),
+			)
+		},
+		In:  os.Stdin,
+		Out: os.Stdout,
+	}
+	if err := lsp.Run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntime
+	}
+	return exitOK
+}
@@ -0,0 +1,35 @@
+#!/bin/sh
+# 用树遍历解释器和字节码虚拟机分别运行 examples 下的所有脚本，比较两者的输出，
+# 测试文件（*_test.hc）用 hercode test 运行
+# 用法：sh examples/compare.sh [hercode 可执行文件]，不给出时先构建到临时目录
+DIR=$(dirname "$0")
+if [ -n "$1" ]; then
+	HERCODE=$1
+else
+	TMP=$(mktemp -d) || exit 2
+	trap 'rm -rf "$TMP"' EXIT
+	HERCODE=$TMP/hercode
+	(cd "$DIR/.." && go build -o "$HERCODE" .) || exit 2
+fi
+INPUT='小红
+18
+没有了
+'
+status=0
+for f in "$DIR"/*.hc; do
+	cmd=run
+	case "$f" in *_test.hc) cmd=test ;; esac
+	a=$(printf '%s' "$INPUT" | "$HERCODE" $cmd "$f" 2>&1)
+	b=$(printf '%s' "$INPUT" | "$HERCODE" $cmd -vm "$f" 2>&1)
+	if [ "$a" = "$b" ]; then
+		echo "ok   $f"
+	else
+		echo "FAIL $f"
+		echo "--- 树遍历解释器"
+		echo "$a"
+		echo "--- 字节码虚拟机"
+		echo "$b"
+		status=1
+	fi
+done
+exit $status
@@ -0,0 +1,66 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ask语句：显示提示并读取一行输入，存入变量
+type AskStmt struct {
+	Prompt   Expression
+	VarName  string
+	AsNumber bool // 把输入转换为数字
+}
+
+func (s *AskStmt) String() string {
+	if s.AsNumber {
+		return fmt.Sprintf("ask %s into %s as number", s.Prompt, s.VarName)
+	}
+	return fmt.Sprintf("ask %s into %s", s.Prompt, s.VarName)
+}
+
+func (s *AskStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
+	prompt, err := s.Prompt.Eval(ctx)
+	if err != nil {
+		return Value{}, err
+	}
+	if prompt.Type == ErrorType {
+		return prompt, nil
+	}
+
+	val, err := ask(ctx, prompt, s.VarName, s.AsNumber)
+	if err != nil || val.Type == ErrorType {
+		return val, err
+	}
+	ctx.SetVar(s.VarName, val)
+	return Value{Type: VoidType}, nil
+}
+
+// 显示提示并读取输入，返回要存入变量的值，树遍历解释器和字节码虚拟机共用
+func ask(ctx *Context, prompt Value, varName string, asNumber bool) (Value, error) {
+	line, err := ctx.ReadLine(prompt.String())
+	if err != nil {
+		if isFatal(err) {
+			return Value{}, err
+		}
+		return Value{Type: ErrorType, Error: err}, nil
+	}
+
+	val := Value{Type: StringType, Str: line}
+	if asNumber {
+		num, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+		if err != nil {
+			return Value{Type: ErrorType, Error: errorf(msgInputNotNumber, line, varName)}, nil
+		}
+		val = Value{Type: NumberType, Num: num}
+	}
+	if err := ctx.checkValue(val); err != nil {
+		return Value{}, err
+	}
+	return val, nil
+}
@@ -9,6 +9,10 @@ type AssignStmt struct {
 }
 
 func (s *AssignStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	val, err := s.Expr.Eval(ctx)
 	if err != nil {
 		return Value{}, err
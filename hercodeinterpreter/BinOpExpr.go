@@ -14,13 +14,16 @@ func (e *BinOpExpr) String() string {
 	return fmt.Sprintf("%s %s %s", e.Left, e.Operator, e.Right)
 }
 func (e *BinOpExpr) Eval(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
 
 	// 处理赋值操作
 	if e.Operator == "=" {
 		// 左侧必须是变量引用
 		leftVar, ok := e.Left.(*VarRefExpr)
 		if !ok {
-			return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 赋值操作左侧必须是变量", e.lineNum)}, nil
+			return Value{Type: ErrorType, Error: errorf(msgAtLine, e.lineNum, lazyMsg(msgAssignToNonVar))}, nil
 		}
 
 		// 计算右侧值
@@ -53,45 +56,55 @@ func (e *BinOpExpr) Eval(ctx *Context) (Value, error) {
 		return rightVal, nil
 	}
 
-	switch e.Operator {
+	return binaryOp(ctx, e.Operator, leftVal, rightVal, e.lineNum)
+}
+
+// 计算二元运算，树遍历解释器和字节码虚拟机共用
+func binaryOp(ctx *Context, operator string, leftVal, rightVal Value, lineNum int) (Value, error) {
+	switch operator {
 	case "+":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
 			return Value{Type: NumberType, Num: leftVal.Num + rightVal.Num}, nil
 		}
 		if leftVal.Type == StringType || rightVal.Type == StringType {
-			return Value{Type: StringType, Str: fmt.Sprintf("%v%v", leftVal, rightVal)}, nil
+			str := fmt.Sprintf("%v%v", leftVal, rightVal)
+			if err := ctx.checkStringBytes(len(str)); err != nil {
+				return Value{}, err
+			}
+			return Value{Type: StringType, Str: str}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s + %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "+", rightVal.Type)}, nil
 
 	case "-":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
 			return Value{Type: NumberType, Num: leftVal.Num - rightVal.Num}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s - %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "-", rightVal.Type)}, nil
 
 	case "*":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
 			return Value{Type: NumberType, Num: leftVal.Num * rightVal.Num}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s * %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "*", rightVal.Type)}, nil
 
 	case "/":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
 			if rightVal.Num == 0 {
-				return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 除以零错误", e.lineNum)}, nil
+				return Value{Type: ErrorType, Error: errorf(msgDivByZero, lineNum)}, nil
 			}
 			return Value{Type: NumberType, Num: leftVal.Num / rightVal.Num}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s / %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "/", rightVal.Type)}, nil
 
 	case "%":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
-			if rightVal.Num == 0 {
-				return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 取模运算除以零错误", e.lineNum)}, nil
+			// 取模按整数计算，0.5 之类的除数取整后也是零
+			if int(rightVal.Num) == 0 {
+				return Value{Type: ErrorType, Error: errorf(msgModByZero, lineNum)}, nil
 			}
 			return Value{Type: NumberType, Num: float64(int(leftVal.Num) % int(rightVal.Num))}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s %% %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "%", rightVal.Type)}, nil
 
 	case "==":
 		if leftVal.Type == rightVal.Type {
@@ -126,7 +139,7 @@ func (e *BinOpExpr) Eval(ctx *Context) (Value, error) {
 		if leftVal.Type == StringType && rightVal.Type == StringType {
 			return Value{Type: BoolType, Bool: leftVal.Str < rightVal.Str}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s < %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "<", rightVal.Type)}, nil
 
 	case ">":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
@@ -135,7 +148,7 @@ func (e *BinOpExpr) Eval(ctx *Context) (Value, error) {
 		if leftVal.Type == StringType && rightVal.Type == StringType {
 			return Value{Type: BoolType, Bool: leftVal.Str > rightVal.Str}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s > %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, ">", rightVal.Type)}, nil
 
 	case "<=":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
@@ -144,7 +157,7 @@ func (e *BinOpExpr) Eval(ctx *Context) (Value, error) {
 		if leftVal.Type == StringType && rightVal.Type == StringType {
 			return Value{Type: BoolType, Bool: leftVal.Str <= rightVal.Str}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s <= %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, "<=", rightVal.Type)}, nil
 
 	case ">=":
 		if leftVal.Type == NumberType && rightVal.Type == NumberType {
@@ -153,9 +166,9 @@ func (e *BinOpExpr) Eval(ctx *Context) (Value, error) {
 		if leftVal.Type == StringType && rightVal.Type == StringType {
 			return Value{Type: BoolType, Bool: leftVal.Str >= rightVal.Str}, nil
 		}
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 类型不匹配: %s >= %s", e.lineNum, leftVal.Type, rightVal.Type)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgTypeMismatch, lineNum, leftVal.Type, ">=", rightVal.Type)}, nil
 
 	default:
-		return Value{Type: ErrorType, Error: fmt.Errorf("行 %d, 未知运算符: %s", e.lineNum, e.Operator)}, nil
+		return Value{Type: ErrorType, Error: errorf(msgAtLine, lineNum, lazyMsg(msgUnknownOp, operator))}, nil
 	}
 }
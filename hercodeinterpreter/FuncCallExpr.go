@@ -2,7 +2,6 @@ package hercodeinterpreter
 
 import (
 	"fmt"
-	"math"
 	"strings"
 )
 
@@ -10,6 +9,11 @@ import (
 type FuncCallExpr struct {
 	Name      string
 	Arguments []Expression
+	Line      int
+
+	// 名字解析的结果，见 resolver.go
+	resolved bool
+	fn       *HerCodeFunction // 调用的用户函数，为 nil 时调用内置函数
 }
 
 func (e *FuncCallExpr) String() string {
@@ -22,12 +26,24 @@ func (e *FuncCallExpr) String() string {
 }
 
 func (e *FuncCallExpr) Eval(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	// 查找函数
 	//fmt.Printf("正在执行函数：%s 参数：%v\n", e.Name, e.Arguments)
 
-	fn, ok := ctx.GetFunc(e.Name)
+	fn, ok := e.fn, e.fn != nil
+	if !e.resolved {
+		fn, ok = ctx.GetFunc(e.Name)
+	}
+	var builtin *Builtin
+	var isBuiltin bool
 	if !ok {
-		return Value{Type: ErrorType, Error: fmt.Errorf("函数未定义: %s", e.Name)}, nil
+		builtin, isBuiltin = ctx.GetBuiltin(e.Name)
+	}
+	if !ok && !isBuiltin {
+		return Value{Type: ErrorType, Error: errorf(msgUndefinedFunc, e.Name, didYouMean(e.Name, ctx.funcNames(), keywords))}, nil
 	}
 
 	// 计算参数值
@@ -43,61 +59,24 @@ func (e *FuncCallExpr) Eval(ctx *Context) (Value, error) {
 		args[i] = argVal
 	}
 
-	// 处理内置函数
-	if e.Name == "len" {
-		if len(args) != 1 {
-			return Value{Type: ErrorType, Error: fmt.Errorf("len() 需要1个参数")}, nil
-		}
-		if args[0].Type != StringType {
-			return Value{Type: ErrorType, Error: fmt.Errorf("len() 需要字符串参数")}, nil
-		}
-		return Value{Type: NumberType, Num: float64(len(args[0].Str))}, nil
+	// 处理内置函数，同名时用户函数优先
+	if !ok {
+		return builtin.Call(ctx, args)
 	}
 
-	if e.Name == "substr" {
-		if len(args) < 2 || len(args) > 3 {
-			return Value{Type: ErrorType, Error: fmt.Errorf("substr() 需要2-3个参数")}, nil
-		}
-
-		if args[0].Type != StringType {
-			return Value{Type: ErrorType, Error: fmt.Errorf("substr() 第一个参数必须是字符串")}, nil
-		}
-
-		if args[1].Type != NumberType {
-			return Value{Type: ErrorType, Error: fmt.Errorf("substr() 第二个参数必须是数字")}, nil
-		}
-
-		start := int(args[1].Num)
-		if start < 0 || start >= len(args[0].Str) {
-			return Value{Type: ErrorType, Error: fmt.Errorf("substr() 起始位置超出范围")}, nil
-		}
-
-		end := len(args[0].Str)
-		if len(args) == 3 {
-			if args[2].Type != NumberType {
-				return Value{Type: ErrorType, Error: fmt.Errorf("substr() 第三个参数必须是数字")}, nil
-			}
-			end = int(args[2].Num)
-			if end < start || end > len(args[0].Str) {
-				return Value{Type: ErrorType, Error: fmt.Errorf("substr() 结束位置超出范围")}, nil
-			}
-		}
+	return callFunction(ctx, fn, args)
+}
 
-		return Value{Type: StringType, Str: args[0].Str[start:end]}, nil
+// 在 ctx 之下创建新的执行上下文，绑定参数并执行用户函数
+func callFunction(ctx *Context, fn *HerCodeFunction, args []Value) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return Value{}, &TimeoutError{Func: fn.Name, Cause: err}
 	}
-
-	if e.Name == "sqrt" {
-		if len(args) != 1 {
-			return Value{Type: ErrorType, Error: fmt.Errorf("sqrt() 需要1个参数")}, nil
-		}
-		if args[0].Type != NumberType {
-			return Value{Type: ErrorType, Error: fmt.Errorf("sqrt() 需要数字参数")}, nil
-		}
-		if args[0].Num < 0 {
-			return Value{Type: ErrorType, Error: fmt.Errorf("sqrt() 参数不能为负数")}, nil
-		}
-		return Value{Type: NumberType, Num: math.Sqrt(args[0].Num)}, nil
+	exit, err := ctx.enterCall(fn.Name)
+	if err != nil {
+		return Value{}, err
 	}
+	defer exit()
 
 	// 创建新的执行上下文
 	localCtx := NewContext(ctx)
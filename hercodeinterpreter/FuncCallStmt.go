@@ -9,6 +9,9 @@ import (
 type FuncCallStmt struct {
 	Name      string
 	Arguments []Expression
+	Line      int
+
+	call *FuncCallExpr // 对应的函数调用表达式，第一次执行或名字解析时创建
 }
 
 func (s *FuncCallStmt) String() string {
@@ -24,14 +27,16 @@ func (s *FuncCallStmt) String() string {
 }
 
 func (s *FuncCallStmt) Execute(ctx *Context) (Value, error) {
-	// 创建函数调用表达式
-	callExpr := &FuncCallExpr{
-		Name:      s.Name,
-		Arguments: s.Arguments,
+	if err := ctx.step(); err != nil {
+		return Value{}, err
 	}
+
 	//fmt.Printf("调用函数：%s, 参数: %s", s.Name, s.Arguments)
 	// 执行函数调用
-	result, _ := callExpr.Eval(ctx)
+	result, err := s.callExpr().Eval(ctx)
+	if err != nil {
+		return Value{}, err
+	}
 
 	if result.Error != nil {
 		return Value{}, result.Error
@@ -43,3 +48,11 @@ func (s *FuncCallStmt) Execute(ctx *Context) (Value, error) {
 	// 忽略返回值
 	return Value{Type: VoidType}, result.Error
 }
+
+// 函数调用表达式
+func (s *FuncCallStmt) callExpr() *FuncCallExpr {
+	if s.call == nil {
+		s.call = &FuncCallExpr{Name: s.Name, Arguments: s.Arguments, Line: s.Line}
+	}
+	return s.call
+}
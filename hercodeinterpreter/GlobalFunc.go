@@ -1,7 +1,6 @@
 package hercodeinterpreter
 
 import (
-	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -14,7 +13,7 @@ func parseExpression(exprStr string, LineNum int) (Expression, error) {
 	exprStr = strings.TrimSpace(exprStr)
 	// 检查是否为空表达式
 	if exprStr == "" {
-		return nil, fmt.Errorf("行 %d, 空表达式", LineNum)
+		return nil, errorf(msgEmptyExpr, LineNum)
 	}
 	// 调试输出
 	//fmt.Printf("解析表达式: %s\n", exprStr)
@@ -36,19 +35,19 @@ func parseExpression(exprStr string, LineNum int) (Expression, error) {
 		if len(parts) > 1 {
 			left, err := parseExpression(strings.TrimSpace(parts[0]), LineNum)
 			if err != nil {
-				return nil, fmt.Errorf("解析左侧表达式失败: %v", err)
+				return nil, errorf(msgParseLeft, err)
 			}
 
 			right, err := parseExpression(strings.TrimSpace(strings.Join(parts[1:], op)), LineNum)
 			if err != nil {
-				return nil, fmt.Errorf("解析右侧表达式失败: %v", err)
+				return nil, errorf(msgParseRight, err)
 			}
 
 			return &BinOpExpr{Left: left, Operator: op, Right: right}, nil
 		}
 	}
 
-	return nil, fmt.Errorf("行 %d, 无法解析表达式: %s", LineNum, exprStr)
+	return nil, errorf(msgBadExpr, LineNum, exprStr)
 }
 
 // 解析简单表达式（字面量、变量）
@@ -59,7 +58,7 @@ func parseSimpleExpression(exprStr string, lineNum int) (Expression, error) {
 	}
 
 	// 字符串字面量
-	if len(exprStr) >= 2 && exprStr[0] == '"' && exprStr[len(exprStr)-1] == '"' {
+	if isStringLiteral(exprStr) {
 		return &LiteralExpr{Value{Type: StringType, Str: exprStr[1 : len(exprStr)-1]}}, nil
 	}
 
@@ -72,17 +71,17 @@ func parseSimpleExpression(exprStr string, lineNum int) (Expression, error) {
 	}
 
 	// 变量引用
-	if regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`).MatchString(exprStr) {
-		return &VarRefExpr{Name: exprStr}, nil
+	if regexp.MustCompile(`^` + identPattern + `$`).MatchString(exprStr) {
+		return &VarRefExpr{Name: exprStr, Line: lineNum}, nil
 	}
 
-	return nil, fmt.Errorf("行 %d, 不是简单表达式", lineNum)
+	return nil, errorf(msgNotSimpleExpr, lineNum)
 }
 
 // 解析函数调用
 func parseFunctionCall(exprStr string, lineNum int) (Expression, error) {
 	// 函数调用
-	if matches := regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\((.*)\)$`).FindStringSubmatch(exprStr); matches != nil {
+	if matches := regexp.MustCompile(`^(` + identPattern + `)\((.*)\)$`).FindStringSubmatch(exprStr); matches != nil {
 		funcName := matches[1]
 		argsStr := matches[2]
 
@@ -99,10 +98,10 @@ func parseFunctionCall(exprStr string, lineNum int) (Expression, error) {
 			}
 		}
 
-		return &FuncCallExpr{Name: funcName, Arguments: args}, nil
+		return &FuncCallExpr{Name: funcName, Arguments: args, Line: lineNum}, nil
 	}
 
-	return nil, fmt.Errorf("行 %d, 不是函数调用", lineNum)
+	return nil, errorf(msgNotFuncCall, lineNum)
 }
 
 // 解析语句
@@ -119,7 +118,7 @@ func parseStatement(stmtStr string, lineNum int) (Statement, error) {
 
 		condExpr, err := parseExpression(condStr, lineNum)
 		if err != nil {
-			return nil, fmt.Errorf("行 %d, 解析条件表达式失败: %v", lineNum, err)
+			return nil, errorf(msgBadCondition, lineNum, err)
 		}
 		return &IfStmt{
 			Condition:  condExpr,
@@ -136,20 +135,30 @@ func parseStatement(stmtStr string, lineNum int) (Statement, error) {
 
 		condExpr, err := parseExpression(condStr, lineNum)
 		if err != nil {
-			return nil, fmt.Errorf("行 %d, 解析条件表达式失败: %v", lineNum, err)
+			return nil, errorf(msgBadCondition, lineNum, err)
 		}
 		return &WhileStmt{
 			Condition: condExpr,
 			Body:      []Statement{},
+			Line:      lineNum,
 		}, nil
 	}
 
+	// Ask语句：ask "提示" into 变量 [as number]
+	if matches := regexp.MustCompile(`^ask\s+(.*)\s+into\s+(` + identPattern + `)(\s+as\s+number)?$`).FindStringSubmatch(stmtStr); matches != nil {
+		prompt, err := parseExpression(strings.TrimSpace(matches[1]), lineNum)
+		if err != nil {
+			return nil, errorf(msgBadAskPrompt, lineNum, err)
+		}
+		return &AskStmt{Prompt: prompt, VarName: matches[2], AsNumber: matches[3] != ""}, nil
+	}
+
 	// 赋值语句
-	if matches := regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*(.*)$`).FindStringSubmatch(stmtStr); matches != nil {
+	if matches := regexp.MustCompile(`^(` + identPattern + `)\s*=\s*(.*)$`).FindStringSubmatch(stmtStr); matches != nil {
 		varName := matches[1]
 		expr, err := parseExpression(strings.TrimSpace(matches[2]), lineNum)
 		if err != nil {
-			return nil, fmt.Errorf("行 %d, 解析赋值表达式错误: %v", lineNum, err)
+			return nil, errorf(msgBadAssign, lineNum, err)
 		}
 		return &AssignStmt{VarName: varName, Expr: expr}, nil
 	}
@@ -168,10 +177,13 @@ func parseStatement(stmtStr string, lineNum int) (Statement, error) {
 	if strings.HasPrefix(stmtStr, "var ") {
 		parts := strings.SplitN(strings.TrimPrefix(stmtStr, "var "), "=", 2)
 		if len(parts) != 2 {
-			return nil, fmt.Errorf("行 %d, 无效的变量声明: %s", lineNum, stmtStr)
+			return nil, errorf(msgBadVarDecl, lineNum, stmtStr)
 		}
 
 		varName := strings.TrimSpace(parts[0])
+		if !isIdent(varName) {
+			return nil, errorf(msgBadName, lineNum, varName)
+		}
 		expr, err := parseExpression(strings.TrimSpace(parts[1]), lineNum)
 		if err != nil {
 			return nil, err
@@ -191,22 +203,24 @@ func parseStatement(stmtStr string, lineNum int) (Statement, error) {
 	}
 
 	// 函数调用
-	if regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\(.*\)$`).MatchString(stmtStr) {
+	if regexp.MustCompile(`^(` + identPattern + `)\(.*\)$`).MatchString(stmtStr) {
 		expr, err := parseExpression(stmtStr, lineNum)
 		if err != nil {
 			return nil, err
 		}
 		fnCall, ok := expr.(*FuncCallExpr)
 		if !ok {
-			return nil, fmt.Errorf("行 %d, 无效的函数调用: %s", lineNum, stmtStr)
+			return nil, errorf(msgBadCall, lineNum, stmtStr)
 		}
-		return &FuncCallStmt{Name: fnCall.Name, Arguments: fnCall.Arguments}, nil
+		return &FuncCallStmt{Name: fnCall.Name, Arguments: fnCall.Arguments, Line: lineNum}, nil
 	}
 
 	// 变量引用（作为函数调用）
-	if regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`).MatchString(stmtStr) {
-		return &FuncCallStmt{Name: stmtStr, Arguments: []Expression{}}, nil
+	if regexp.MustCompile(`^` + identPattern + `$`).MatchString(stmtStr) {
+		return &FuncCallStmt{Name: stmtStr, Arguments: []Expression{}, Line: lineNum}, nil
 	}
 
-	return nil, fmt.Errorf("行 %d, 无法解析语句: %s", lineNum, stmtStr)
+	// 语句开头的单词可能是拼错的关键字
+	word := regexp.MustCompile(`^` + identPattern).FindString(stmtStr)
+	return nil, errorf(msgBadStmt, lineNum, stmtStr, didYouMean(word, keywords))
 }
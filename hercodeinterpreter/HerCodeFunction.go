@@ -10,6 +10,7 @@ type HerCodeFunction struct {
 	Parameters []string
 	Statements []Statement
 	ReturnType ValueType
+	Line       int // 定义所在的行
 }
 
 func NewHerCodeFunction(name string) *HerCodeFunction {
@@ -1,7 +1,6 @@
 package hercodeinterpreter
 
 import (
-	"fmt"
 	"strings"
 )
 
@@ -40,6 +39,10 @@ func (s *IfStmt) String() string {
 }
 
 func (s *IfStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	condVal, err := s.Condition.Eval(ctx)
 	if err != nil {
 		return Value{}, err
@@ -49,7 +52,7 @@ func (s *IfStmt) Execute(ctx *Context) (Value, error) {
 	}
 
 	if condVal.Type != BoolType {
-		return Value{Type: ErrorType, Error: fmt.Errorf("条件表达式必须为布尔类型")}, nil
+		return Value{Type: ErrorType, Error: errorf(msgConditionNotBool)}, nil
 	}
 
 	if condVal.Bool {
@@ -8,6 +8,10 @@ type ReturnStmt struct {
 }
 
 func (s *ReturnStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	val, err := s.Expr.Eval(ctx)
 	if err != nil {
 		return Value{}, err
@@ -13,6 +13,10 @@ func (s *VarDeclStmt) String() string {
 }
 
 func (s *VarDeclStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	val, err := s.Expr.Eval(ctx)
 	if err != nil {
 		return Value{}, err
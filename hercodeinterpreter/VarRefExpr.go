@@ -5,12 +5,20 @@ import "fmt"
 // 变量引用表达式
 type VarRefExpr struct {
 	Name string
+	Line int
 }
 
 func (e *VarRefExpr) Eval(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	val, ok := ctx.GetVar(e.Name)
 	if !ok {
-		return Value{Type: ErrorType, Error: fmt.Errorf("变量未定义: %s", e.Name)}, nil
+		val, ok = builtinConstants[e.Name]
+	}
+	if !ok {
+		return Value{Type: ErrorType, Error: errorf(msgUndefinedVar, e.Name, didYouMean(e.Name, ctx.varNames()))}, nil
 	}
 	return val, nil
 }
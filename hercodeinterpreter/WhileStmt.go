@@ -6,6 +6,13 @@ import "fmt"
 type WhileStmt struct {
 	Condition Expression
 	Body      []Statement
+	Line      int
+
+	// 死循环检测的分析结果，见 analyze
+	analyzed     bool
+	condVars     []string // 条件中引用的变量
+	condPure     bool     // 条件和循环体中都没有函数调用，条件只依赖 condVars
+	neverChanges bool     // 循环体里从未给 condVars 赋值，也没有 return
 }
 
 func (s *WhileStmt) String() string {
@@ -17,7 +24,24 @@ func (s *WhileStmt) String() string {
 }
 
 func (s *WhileStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
+	beginner := ctx.BeginnerMode()
+	var before []Value
+	if beginner {
+		s.analyze()
+	}
+
 	for {
+		if err := ctx.Err(); err != nil {
+			return Value{}, &TimeoutError{Line: s.Line, Cause: err}
+		}
+		if err := ctx.step(); err != nil {
+			return Value{}, err
+		}
+
 		condVal, err := s.Condition.Eval(ctx)
 		if err != nil {
 			return Value{}, err
@@ -27,13 +51,22 @@ func (s *WhileStmt) Execute(ctx *Context) (Value, error) {
 		}
 
 		if condVal.Type != BoolType {
-			return Value{Type: ErrorType, Error: fmt.Errorf("条件表达式必须为布尔类型")}, nil
+			return Value{Type: ErrorType, Error: errorf(msgConditionNotBool)}, nil
 		}
 
 		if !condVal.Bool {
 			break
 		}
 
+		// 新手模式下检测死循环：条件成立而且条件中的变量不会再变化
+		if beginner && s.condPure && len(s.condVars) > 0 {
+			now := s.snapshot(ctx)
+			if s.neverChanges || before != nil && snapshotsEqual(before, now) {
+				return Value{}, &InfiniteLoopError{Line: s.Line, Vars: s.condVars, first: now[0]}
+			}
+			before = now
+		}
+
 		for _, stmt := range s.Body {
 			result, err := stmt.Execute(ctx)
 			if err != nil {
@@ -0,0 +1,119 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ==================== 语法树输出 ====================
+// hercode ast 用缩进表示语法树的层次，每个节点一行，例如：
+//
+//	function double(n) line 1
+//	  Return
+//	    BinOp *
+//	      VarRef n
+//	      Literal 2
+
+// 按定义的顺序输出 Parse 得到的所有函数的语法树，start 也是一个函数
+func (h *HerCodeInterpreter) WriteAST(w io.Writer) {
+	funcs := make([]*HerCodeFunction, 0, len(h.GlobalCtx.Functions))
+	for _, fn := range h.GlobalCtx.Functions {
+		funcs = append(funcs, fn)
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Line != funcs[j].Line {
+			return funcs[i].Line < funcs[j].Line
+		}
+		return funcs[i].Name < funcs[j].Name
+	})
+
+	for _, fn := range funcs {
+		if fn.Name == "start" {
+			fmt.Fprintf(w, "start line %d\n", fn.Line)
+		} else {
+			fmt.Fprintf(w, "function %s(%s) line %d\n", fn.Name, strings.Join(fn.Parameters, ", "), fn.Line)
+		}
+		writeStmts(w, 1, fn.Statements)
+	}
+}
+
+func writeStmts(w io.Writer, depth int, stmts []Statement) {
+	for _, stmt := range stmts {
+		writeNode(w, depth, stmt)
+	}
+}
+
+// 输出一个语句或表达式节点及其子节点
+func writeNode(w io.Writer, depth int, node any) {
+	indent := strings.Repeat("  ", depth)
+	switch n := node.(type) {
+	case *SayStmt:
+		fmt.Fprintf(w, "%sSay\n", indent)
+		writeNode(w, depth+1, n.Expr)
+	case *VarDeclStmt:
+		fmt.Fprintf(w, "%sVarDecl %s\n", indent, n.VarName)
+		writeNode(w, depth+1, n.Expr)
+	case *AssignStmt:
+		fmt.Fprintf(w, "%sAssign %s\n", indent, n.VarName)
+		writeNode(w, depth+1, n.Expr)
+	case *AskStmt:
+		if n.AsNumber {
+			fmt.Fprintf(w, "%sAsk %s as number\n", indent, n.VarName)
+		} else {
+			fmt.Fprintf(w, "%sAsk %s\n", indent, n.VarName)
+		}
+		writeNode(w, depth+1, n.Prompt)
+	case *ReturnStmt:
+		fmt.Fprintf(w, "%sReturn\n", indent)
+		writeNode(w, depth+1, n.Expr)
+	case *FuncCallStmt:
+		fmt.Fprintf(w, "%sCall %s\n", indent, n.Name)
+		for _, arg := range n.Arguments {
+			writeNode(w, depth+1, arg)
+		}
+	case *IfStmt:
+		fmt.Fprintf(w, "%sIf\n", indent)
+		writeNode(w, depth+1, n.Condition)
+		fmt.Fprintf(w, "%s  Then\n", indent)
+		writeStmts(w, depth+2, n.ThenBranch)
+		if n.ElseBranch != nil {
+			fmt.Fprintf(w, "%s  Else\n", indent)
+			writeStmts(w, depth+2, n.ElseBranch)
+		}
+	case *WhileStmt:
+		fmt.Fprintf(w, "%sWhile line %d\n", indent, n.Line)
+		writeNode(w, depth+1, n.Condition)
+		fmt.Fprintf(w, "%s  Body\n", indent)
+		writeStmts(w, depth+2, n.Body)
+	case *BinOpExpr:
+		fmt.Fprintf(w, "%sBinOp %s\n", indent, n.Operator)
+		writeNode(w, depth+1, n.Left)
+		writeNode(w, depth+1, n.Right)
+	case *FuncCallExpr:
+		fmt.Fprintf(w, "%sCall %s\n", indent, n.Name)
+		for _, arg := range n.Arguments {
+			writeNode(w, depth+1, arg)
+		}
+	case *VarRefExpr:
+		fmt.Fprintf(w, "%sVarRef %s\n", indent, n.Name)
+	case *LiteralExpr:
+		fmt.Fprintf(w, "%sLiteral %s\n", indent, literalString(n.Value))
+	default:
+		fmt.Fprintf(w, "%s%T\n", indent, node)
+	}
+}
+
+// 字面量按源代码的写法输出，字符串带引号
+func literalString(v Value) string {
+	switch v.Type {
+	case NumberType:
+		return strconv.FormatFloat(v.Num, 'g', -1, 64)
+	case StringType:
+		return strconv.Quote(v.Str)
+	default:
+		return v.String()
+	}
+}
@@ -0,0 +1,153 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 内置函数的 Go 实现，调用前参数个数和类型已经按签名检查过
+type BuiltinFunc func(ctx *Context, args []Value) (Value, error)
+
+// 内置函数的参数
+type Param struct {
+	Name  string
+	Types []ValueType // 允许的类型，为空表示任意类型
+}
+
+// 内置函数
+type Builtin struct {
+	Name     string
+	Params   []Param // 参数签名
+	MinArgs  int     // 必填参数个数，Params 中其余的参数可以省略
+	Variadic bool    // 最后一个参数可以重复任意次
+	Fn       BuiltinFunc
+}
+
+// 用户函数与内置函数同名时的处理策略
+type ShadowPolicy int
+
+const (
+	ShadowAllow ShadowPolicy = iota // 允许同名，调用时用户函数优先
+	ShadowDeny                      // 不允许同名，解析时报错
+)
+
+// 默认内置函数表，各标准库在 init 中注册到这里
+var defaultBuiltins = map[string]*Builtin{}
+
+// 注册默认内置函数
+func registerBuiltin(b *Builtin) {
+	defaultBuiltins[b.Name] = b
+}
+
+// 构造参数签名
+func param(name string, types ...ValueType) Param {
+	return Param{Name: name, Types: types}
+}
+
+// 签名，例如 substr(str 字符串, start 数字, [end 数字])
+func (b *Builtin) Signature() string {
+	return b.SignatureIn("")
+}
+
+// 按语言 l 写出签名中的类型名，l 为空时使用默认语言
+func (b *Builtin) SignatureIn(l Lang) string {
+	params := make([]string, len(b.Params))
+	for i, p := range b.Params {
+		s := p.Name
+		if len(p.Types) > 0 {
+			types := make([]string, len(p.Types))
+			for j, t := range p.Types {
+				types[j] = t.inLang(l)
+			}
+			s += " " + strings.Join(types, "|")
+		}
+		if b.Variadic && i == len(b.Params)-1 {
+			s += "..."
+		}
+		if i >= b.MinArgs {
+			s = "[" + s + "]"
+		}
+		params[i] = s
+	}
+	return fmt.Sprintf("%s(%s)", b.Name, strings.Join(params, ", "))
+}
+
+// 检查参数个数和类型
+func (b *Builtin) checkArgs(args []Value) error {
+	if len(args) < b.MinArgs || (!b.Variadic && len(args) > len(b.Params)) {
+		return errorf(msgArity, b.Name, b.arity(), len(args))
+	}
+
+	for i, arg := range args {
+		p := b.Params[min(i, len(b.Params)-1)]
+		if len(p.Types) == 0 {
+			continue
+		}
+		ok := false
+		for _, t := range p.Types {
+			if arg.Type == t {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errorf(msgArgType, b.Name, i+1, p.Name, typeNames(p.Types), arg.Type)
+		}
+	}
+	return nil
+}
+
+// 调用内置函数，普通错误以 ErrorType 值返回，超时或超出资源限制时返回 error
+func (b *Builtin) Call(ctx *Context, args []Value) (Value, error) {
+	if err := b.checkArgs(args); err != nil {
+		return Value{Type: ErrorType, Error: err}, nil
+	}
+	val, err := b.Fn(ctx, args)
+	if err == nil {
+		err = ctx.checkValue(val)
+	}
+	if err != nil {
+		if isFatal(err) {
+			return Value{}, err
+		}
+		return Value{Type: ErrorType, Error: err}, nil
+	}
+	return val, nil
+}
+
+func (b *Builtin) arity() lazyText {
+	return func(l Lang) string {
+		switch {
+		case b.Variadic:
+			return format(l, msgAtLeast, []any{b.MinArgs})
+		case b.MinArgs == len(b.Params):
+			return fmt.Sprintf("%d", b.MinArgs)
+		default:
+			return fmt.Sprintf("%d-%d", b.MinArgs, len(b.Params))
+		}
+	}
+}
+
+func typeNames(types []ValueType) lazyText {
+	return func(l Lang) string {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = t.inLang(l)
+		}
+		if len(names) == 1 {
+			return names[0]
+		}
+		return strings.Join(names[:len(names)-1], format(l, msgListSep, nil)) + format(l, msgOr, nil) + names[len(names)-1]
+	}
+}
+
+// 辅助函数：取整数参数，类型已由签名检查
+func argInt(name string, args []Value, i int) (int, error) {
+	n := args[i].Num
+	// 先排除 NaN、无穷大和超出 int 范围的数，float64 到 int 的转换对这些数没有定义
+	if math.IsNaN(n) || n < math.MinInt || n >= math.MaxInt || n != float64(int(n)) {
+		return 0, errorf(msgArgInt, name, i+1)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,37 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const shadowScript = `function upper s:
+    return "mine"
+end
+
+start:
+    say upper("x")
+end
+`
+
+// ShadowAllow 时用户函数覆盖同名的内置函数，ShadowDeny 时解析报错
+func TestWithShadowPolicy(t *testing.T) {
+	for _, vm := range []bool{false, true} {
+		var out bytes.Buffer
+		h := NewHerCodeInterpreter(WithStdout(&out), WithVM(vm), WithShadowPolicy(ShadowAllow))
+		if err := h.Parse(shadowScript); err != nil {
+			t.Fatalf("vm=%v: Parse with ShadowAllow: %v", vm, err)
+		}
+		mustExecute(t, h)
+		if out.String() != "mine\n" {
+			t.Errorf("vm=%v: output = %q, want the user function's %q", vm, out.String(), "mine\n")
+		}
+	}
+
+	h := NewHerCodeInterpreter(WithShadowPolicy(ShadowDeny), WithLang(LangEN))
+	err := h.Parse(shadowScript)
+	if err == nil || !strings.Contains(err.Error(), "function upper has the same name as a built-in function") {
+		t.Errorf("Parse with ShadowDeny = %v, want the shadowing error", err)
+	}
+}
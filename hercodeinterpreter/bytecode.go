@@ -0,0 +1,222 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"io"
+)
+
+// ==================== 字节码 ====================
+// 编译器把语法树编译成字节码，由栈式虚拟机执行（见 compiler.go 和 vm.go）。
+// 函数的参数和在函数中赋值过的变量在编译时就分配好槽位，运行时按下标存取，
+// 不再为每次调用创建 Context 和 map。
+
+// 操作码
+type Opcode uint8
+
+const (
+	OpConst      Opcode = iota // 压入常量 Consts[A]
+	OpLoadLocal                // 压入槽位 A 的值，槽位还没有赋值时按名字 Names[B] 向调用者查找
+	OpLoadName                 // 按名字 Names[A] 查找变量并压入
+	OpStoreLocal               // 弹出栈顶，存入槽位 A
+	OpStoreName                // 弹出栈顶，存入全局变量 Names[A]
+	OpAdd                      // 二元运算：弹出两个值，压入结果
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEq
+	OpNe
+	OpLt
+	OpGt
+	OpLe
+	OpGe
+	OpDup         // 复制栈顶
+	OpStmt        // 语句开始，计数一步
+	OpCheckFunc   // 函数调用开始：计数一步，内置函数 Names[A] 不存在时报错
+	OpCall        // 调用用户函数 Funcs[A]，参数个数为 B
+	OpCallBuiltin // 调用内置函数 Names[A]，参数个数为 B
+	OpJump        // 跳转到 A
+	OpJumpIfFalse // 弹出条件，为 false 时跳转到 A，不是布尔值时报错
+	OpLoopInit    // 进入 while 循环 Loops[A]
+	OpLoopEnter   // 每轮循环开始：检查超时，计数一步
+	OpLoopCheck   // 条件成立后：新手模式下检测死循环
+	OpSay         // 弹出并输出
+	OpAsk         // 弹出提示，读取输入并压入，B 为 1 时转换为数字，Names[A] 为变量名
+	OpReturn      // 弹出并从函数返回
+	OpReturnIfSet // 栈顶不是空值时返回它，否则弹出
+)
+
+var opcodeNames = [...]string{
+	OpConst:       "CONST",
+	OpLoadLocal:   "LOAD_LOCAL",
+	OpLoadName:    "LOAD_NAME",
+	OpStoreLocal:  "STORE_LOCAL",
+	OpStoreName:   "STORE_NAME",
+	OpAdd:         "ADD",
+	OpSub:         "SUB",
+	OpMul:         "MUL",
+	OpDiv:         "DIV",
+	OpMod:         "MOD",
+	OpEq:          "EQ",
+	OpNe:          "NE",
+	OpLt:          "LT",
+	OpGt:          "GT",
+	OpLe:          "LE",
+	OpGe:          "GE",
+	OpDup:         "DUP",
+	OpStmt:        "STMT",
+	OpCheckFunc:   "CHECK_FUNC",
+	OpCall:        "CALL",
+	OpCallBuiltin: "CALL_BUILTIN",
+	OpJump:        "JUMP",
+	OpJumpIfFalse: "JUMP_IF_FALSE",
+	OpLoopInit:    "LOOP_INIT",
+	OpLoopEnter:   "LOOP_ENTER",
+	OpLoopCheck:   "LOOP_CHECK",
+	OpSay:         "SAY",
+	OpAsk:         "ASK",
+	OpReturn:      "RETURN",
+	OpReturnIfSet: "RETURN_IF_SET",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) && opcodeNames[op] != "" {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP(%d)", op)
+}
+
+// 二元运算符对应的操作码
+var binaryOpcodes = map[string]Opcode{
+	"+": OpAdd, "-": OpSub, "*": OpMul, "/": OpDiv, "%": OpMod,
+	"==": OpEq, "!=": OpNe, "<": OpLt, ">": OpGt, "<=": OpLe, ">=": OpGe,
+}
+
+// 操作码对应的二元运算符
+var binaryOperators = map[Opcode]string{
+	OpAdd: "+", OpSub: "-", OpMul: "*", OpDiv: "/", OpMod: "%",
+	OpEq: "==", OpNe: "!=", OpLt: "<", OpGt: ">", OpLe: "<=", OpGe: ">=",
+}
+
+// 一条指令
+type Instr struct {
+	Op Opcode
+	A  int32
+	B  int32
+}
+
+// 运行时错误的处理方式，见 Proto.Handlers
+const (
+	handleReturn int32 = -1 // 把错误作为函数的返回值（大多数语句）
+	handleAbort  int32 = -2 // 停止执行并返回 Go 错误（函数调用语句）
+	// 大于等于 0 时为 say 语句：输出错误，然后跳转到该位置继续执行
+)
+
+// while 循环的信息，用于新手模式的死循环检测
+type LoopInfo struct {
+	Line         int
+	Vars         []string // 条件中引用的变量
+	Pure         bool     // 条件和循环体中都没有函数调用
+	NeverChanges bool     // 循环体里从未给 Vars 赋值，也没有 return
+	Slot         int      // 保存上一轮变量值的隐藏槽位
+}
+
+// 编译后的函数
+type Proto struct {
+	Name     string
+	Params   int      // 参数个数，参数占用前 Params 个槽位
+	Locals   []string // 有名字的槽位
+	NumSlots int      // 槽位总数，包括循环检测用的隐藏槽位
+	Global   bool     // 在全局上下文中执行（start 中的顶层语句），变量按名字存取
+	Code     []Instr
+	Handlers []int32 // 每条指令出错时的处理方式
+	Consts   []Value
+	Names    []string
+	Loops    []LoopInfo
+
+	slots map[string]int // 变量名到槽位的索引
+}
+
+// 变量名对应的槽位
+func (p *Proto) slot(name string) (int, bool) {
+	if p.slots == nil {
+		p.slots = make(map[string]int, len(p.Locals))
+		for i, n := range p.Locals {
+			p.slots[n] = i
+		}
+	}
+	i, ok := p.slots[name]
+	return i, ok
+}
+
+// 编译后的程序
+type Program struct {
+	Funcs []*Proto // 用户函数
+	Start []*Proto // start 中的每一条顶层语句
+
+	funcIndex map[string]int
+}
+
+// 按名字查找用户函数
+func (p *Program) Func(name string) (*Proto, bool) {
+	i, ok := p.lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return p.Funcs[i], true
+}
+
+func (p *Program) lookup(name string) (int, bool) {
+	if p.funcIndex == nil {
+		p.funcIndex = make(map[string]int, len(p.Funcs))
+		for i, fn := range p.Funcs {
+			p.funcIndex[fn.Name] = i
+		}
+	}
+	i, ok := p.funcIndex[name]
+	return i, ok
+}
+
+// 打印字节码，用于调试
+func (p *Program) Disassemble(w io.Writer) {
+	for _, fn := range p.Funcs {
+		fn.disassemble(w)
+	}
+	for i, proto := range p.Start {
+		fmt.Fprintf(w, "start 第%d条语句:\n", i+1)
+		proto.disassemble(w)
+	}
+}
+
+func (p *Proto) disassemble(w io.Writer) {
+	if !p.Global {
+		fmt.Fprintf(w, "函数 %s（参数 %d，槽位 %v）:\n", p.Name, p.Params, p.Locals)
+	}
+	for pc, in := range p.Code {
+		fmt.Fprintf(w, "  %4d %-14s", pc, in.Op)
+		switch in.Op {
+		case OpConst:
+			fmt.Fprintf(w, "%d (%s)", in.A, p.Consts[in.A])
+		case OpLoadLocal, OpStoreLocal:
+			fmt.Fprintf(w, "%d (%s)", in.A, p.slotName(int(in.A)))
+		case OpLoadName, OpStoreName, OpCheckFunc:
+			fmt.Fprintf(w, "%d (%s)", in.A, p.Names[in.A])
+		case OpCall:
+			fmt.Fprintf(w, "%d %d", in.A, in.B)
+		case OpCallBuiltin:
+			fmt.Fprintf(w, "%d (%s) %d", in.A, p.Names[in.A], in.B)
+		case OpJump, OpJumpIfFalse, OpLoopInit, OpLoopEnter, OpLoopCheck:
+			fmt.Fprintf(w, "%d", in.A)
+		case OpAsk:
+			fmt.Fprintf(w, "%d (%s) %d", in.A, p.Names[in.A], in.B)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (p *Proto) slotName(i int) string {
+	if i < len(p.Locals) {
+		return p.Locals[i]
+	}
+	return "<隐藏>"
+}
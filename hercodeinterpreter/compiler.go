@@ -0,0 +1,323 @@
+package hercodeinterpreter
+
+import "sort"
+
+// ==================== 字节码编译器 ====================
+
+// 把解析得到的函数和 start 入口编译成字节码
+func (h *HerCodeInterpreter) Compile() (_ *Program, err error) {
+	defer func() { err = h.localize(err) }()
+	prog := &Program{}
+
+	names := make([]string, 0, len(h.GlobalCtx.Functions))
+	for name := range h.GlobalCtx.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prog.Funcs = append(prog.Funcs, &Proto{Name: name})
+	}
+
+	for i, name := range names {
+		fn := h.GlobalCtx.Functions[name]
+		c := &compiler{prog: prog, proto: prog.Funcs[i]}
+		c.proto.Params = len(fn.Parameters)
+		for _, p := range fn.Parameters {
+			c.addLocal(p)
+		}
+		c.declareLocals(fn.Statements)
+		if err := c.compileBlock(fn.Statements); err != nil {
+			return nil, errorf(msgCompileFunc, name, err)
+		}
+		c.finish()
+	}
+
+	if start, ok := h.GlobalCtx.Functions["start"]; ok {
+		for _, stmt := range start.Statements {
+			c := &compiler{prog: prog, proto: &Proto{Name: "start", Global: true}}
+			if err := c.compileStmt(stmt); err != nil {
+				return nil, errorf(msgCompileStart, err)
+			}
+			c.finish()
+			prog.Start = append(prog.Start, c.proto)
+		}
+	}
+	return prog, nil
+}
+
+type compiler struct {
+	prog    *Program
+	proto   *Proto
+	handler int32 // 当前语句出错时的处理方式
+	consts  map[constKey]int32
+	names   map[string]int32
+}
+
+// 登记一个有名字的槽位
+func (c *compiler) addLocal(name string) {
+	if _, ok := c.proto.slot(name); ok {
+		return
+	}
+	c.proto.slots[name] = len(c.proto.Locals)
+	c.proto.Locals = append(c.proto.Locals, name)
+	c.proto.NumSlots = len(c.proto.Locals)
+}
+
+// 函数中被赋值的变量都是局部变量，分配槽位
+func (c *compiler) declareLocals(stmts []Statement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *AssignStmt:
+			c.addLocal(s.VarName)
+		case *VarDeclStmt:
+			c.addLocal(s.VarName)
+		case *AskStmt:
+			c.addLocal(s.VarName)
+		case *IfStmt:
+			c.declareLocals(s.ThenBranch)
+			c.declareLocals(s.ElseBranch)
+		case *WhileStmt:
+			c.declareLocals(s.Body)
+		}
+	}
+}
+
+// 在末尾补上返回空值
+func (c *compiler) finish() {
+	c.handler = handleReturn
+	c.emit(OpConst, c.constant(Value{Type: VoidType}), 0)
+	c.emit(OpReturn, 0, 0)
+}
+
+func (c *compiler) emit(op Opcode, a, b int32) int {
+	c.proto.Code = append(c.proto.Code, Instr{Op: op, A: a, B: b})
+	c.proto.Handlers = append(c.proto.Handlers, c.handler)
+	return len(c.proto.Code) - 1
+}
+
+// 把跳转指令的目标设为当前位置
+func (c *compiler) patch(pc int) {
+	c.proto.Code[pc].A = int32(len(c.proto.Code))
+}
+
+// 常量去重用的键，字面量只有数字、字符串、布尔值和空值
+type constKey struct {
+	Type ValueType
+	Num  float64
+	Str  string
+	Bool bool
+}
+
+func (c *compiler) constant(v Value) int32 {
+	key := constKey{Type: v.Type, Num: v.Num, Str: v.Str, Bool: v.Bool}
+	if i, ok := c.consts[key]; ok {
+		return i
+	}
+	if c.consts == nil {
+		c.consts = make(map[constKey]int32)
+	}
+	c.consts[key] = int32(len(c.proto.Consts))
+	c.proto.Consts = append(c.proto.Consts, v)
+	return c.consts[key]
+}
+
+func (c *compiler) name(s string) int32 {
+	if i, ok := c.names[s]; ok {
+		return i
+	}
+	if c.names == nil {
+		c.names = make(map[string]int32)
+	}
+	c.names[s] = int32(len(c.proto.Names))
+	c.proto.Names = append(c.proto.Names, s)
+	return c.names[s]
+}
+
+func (c *compiler) compileBlock(stmts []Statement) error {
+	for _, stmt := range stmts {
+		if err := c.compileStmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) compileStmt(stmt Statement) error {
+	outer := c.handler
+	defer func() { c.handler = outer }()
+	c.handler = handleReturn
+
+	switch s := stmt.(type) {
+	case *SayStmt:
+		// say 的表达式出错时输出错误并继续执行下一条语句
+		c.emit(OpStmt, 0, 0)
+		start := len(c.proto.Code)
+		if err := c.compileExpr(s.Expr); err != nil {
+			return err
+		}
+		c.emit(OpSay, 0, 0)
+		for pc := start; pc < len(c.proto.Code); pc++ {
+			c.proto.Handlers[pc] = int32(len(c.proto.Code))
+		}
+	case *AssignStmt:
+		return c.compileStore(s.VarName, s.Expr)
+	case *VarDeclStmt:
+		return c.compileStore(s.VarName, s.Expr)
+	case *AskStmt:
+		c.emit(OpStmt, 0, 0)
+		if err := c.compileExpr(s.Prompt); err != nil {
+			return err
+		}
+		asNumber := int32(0)
+		if s.AsNumber {
+			asNumber = 1
+		}
+		c.emit(OpAsk, c.name(s.VarName), asNumber)
+		c.store(s.VarName)
+	case *ReturnStmt:
+		c.emit(OpStmt, 0, 0)
+		if err := c.compileExpr(s.Expr); err != nil {
+			return err
+		}
+		c.emit(OpReturnIfSet, 0, 0)
+	case *FuncCallStmt:
+		// 函数调用语句出错时停止执行
+		c.handler = handleAbort
+		c.emit(OpStmt, 0, 0)
+		if err := c.compileCall(s.Name, s.Arguments); err != nil {
+			return err
+		}
+		c.emit(OpReturnIfSet, 0, 0)
+	case *IfStmt:
+		c.emit(OpStmt, 0, 0)
+		if err := c.compileExpr(s.Condition); err != nil {
+			return err
+		}
+		toElse := c.emit(OpJumpIfFalse, 0, 0)
+		if err := c.compileBlock(s.ThenBranch); err != nil {
+			return err
+		}
+		if len(s.ElseBranch) == 0 {
+			c.patch(toElse)
+			return nil
+		}
+		toEnd := c.emit(OpJump, 0, 0)
+		c.patch(toElse)
+		if err := c.compileBlock(s.ElseBranch); err != nil {
+			return err
+		}
+		c.patch(toEnd)
+	case *WhileStmt:
+		s.analyze()
+		loop := int32(len(c.proto.Loops))
+		c.proto.Loops = append(c.proto.Loops, LoopInfo{
+			Line:         s.Line,
+			Vars:         s.condVars,
+			Pure:         s.condPure,
+			NeverChanges: s.neverChanges,
+			Slot:         c.proto.NumSlots,
+		})
+		c.proto.NumSlots++
+
+		c.emit(OpStmt, 0, 0)
+		c.emit(OpLoopInit, loop, 0)
+		top := int32(c.emit(OpLoopEnter, loop, 0))
+		if err := c.compileExpr(s.Condition); err != nil {
+			return err
+		}
+		toEnd := c.emit(OpJumpIfFalse, 0, 0)
+		c.emit(OpLoopCheck, loop, 0)
+		if err := c.compileBlock(s.Body); err != nil {
+			return err
+		}
+		c.emit(OpJump, top, 0)
+		c.patch(toEnd)
+	default:
+		return errorf(msgUnsupportedStmt, stmt)
+	}
+	return nil
+}
+
+// 计算表达式并存入变量
+func (c *compiler) compileStore(name string, expr Expression) error {
+	c.emit(OpStmt, 0, 0)
+	if err := c.compileExpr(expr); err != nil {
+		return err
+	}
+	c.store(name)
+	return nil
+}
+
+func (c *compiler) store(name string) {
+	if slot, ok := c.proto.slot(name); ok && !c.proto.Global {
+		c.emit(OpStoreLocal, int32(slot), 0)
+		return
+	}
+	c.emit(OpStoreName, c.name(name), 0)
+}
+
+func (c *compiler) compileExpr(expr Expression) error {
+	switch e := expr.(type) {
+	case *LiteralExpr:
+		c.emit(OpConst, c.constant(e.Value), 0)
+	case *VarRefExpr:
+		if slot, ok := c.proto.slot(e.Name); ok && !c.proto.Global {
+			c.emit(OpLoadLocal, int32(slot), c.name(e.Name))
+		} else {
+			c.emit(OpLoadName, c.name(e.Name), 0)
+		}
+	case *BinOpExpr:
+		if e.Operator == "=" {
+			left, ok := e.Left.(*VarRefExpr)
+			if !ok {
+				return errorf(msgAssignToNonVar)
+			}
+			if err := c.compileExpr(e.Right); err != nil {
+				return err
+			}
+			c.emit(OpDup, 0, 0)
+			c.store(left.Name)
+			return nil
+		}
+		op, ok := binaryOpcodes[e.Operator]
+		if !ok {
+			return errorf(msgUnknownOp, e.Operator)
+		}
+		if err := c.compileExpr(e.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpr(e.Right); err != nil {
+			return err
+		}
+		c.emit(op, 0, int32(e.lineNum))
+	case *FuncCallExpr:
+		return c.compileCall(e.Name, e.Arguments)
+	default:
+		return errorf(msgUnsupportedExpr, expr)
+	}
+	return nil
+}
+
+// 函数调用：同名时用户函数优先，内置函数在运行时查找
+func (c *compiler) compileCall(name string, args []Expression) error {
+	index, isUser := c.prog.lookup(name)
+	c.emit(OpCheckFunc, c.name(name), boolOperand(isUser))
+	for _, arg := range args {
+		if err := c.compileExpr(arg); err != nil {
+			return err
+		}
+	}
+	if isUser {
+		c.emit(OpCall, int32(index), int32(len(args)))
+	} else {
+		c.emit(OpCallBuiltin, c.name(name), int32(len(args)))
+	}
+	return nil
+}
+
+func boolOperand(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
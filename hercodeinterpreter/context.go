@@ -1,18 +1,31 @@
 package hercodeinterpreter
 
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
 // 上下文环境
 type Context struct {
 	Variables map[string]Value
 	Functions map[string]*HerCodeFunction
 	Parent    *Context
+	interp    *HerCodeInterpreter // 所属解释器，子上下文从父上下文继承
 }
 
 func NewContext(parent *Context) *Context {
-	return &Context{
+	ctx := &Context{
 		Variables: make(map[string]Value),
 		Functions: make(map[string]*HerCodeFunction), // 确保这里初始化了 Functions 字段
 		Parent:    parent,
 	}
+	if parent != nil {
+		ctx.interp = parent.interp
+	}
+	return ctx
 }
 
 func (c *Context) GetVar(name string) (Value, bool) {
@@ -42,6 +55,131 @@ func (c *Context) SetFunc(name string, fn *HerCodeFunction) {
 	c.Functions[name] = fn
 }
 
+// 查找内置函数，没有所属解释器时使用默认内置函数表
+func (c *Context) GetBuiltin(name string) (*Builtin, bool) {
+	table := defaultBuiltins
+	if c.interp != nil {
+		table = c.interp.Builtins
+	}
+	b, ok := table[name]
+	return b, ok
+}
+
+// 输出，没有所属解释器时为 os.Stdout；设置了 MaxOutputBytes 时会统计输出字节数
+func (c *Context) Stdout() io.Writer {
+	if c.interp == nil || c.interp.Stdout == nil {
+		return os.Stdout
+	}
+	if c.interp.Limits.MaxOutputBytes > 0 {
+		return &limitedWriter{w: c.interp.Stdout, h: c.interp}
+	}
+	return c.interp.Stdout
+}
+
+// 错误输出，没有所属解释器时为 os.Stderr
+func (c *Context) Stderr() io.Writer {
+	if c.interp != nil && c.interp.Stderr != nil {
+		return c.interp.Stderr
+	}
+	return os.Stderr
+}
+
+// 输入，没有所属解释器时为 os.Stdin
+func (c *Context) Stdin() io.Reader {
+	if c.interp != nil && c.interp.Stdin != nil {
+		return c.interp.Stdin
+	}
+	return os.Stdin
+}
+
+// 显示提示并读取一行输入（不含换行符）。
+// 执行超时或被取消时立即返回 *TimeoutError，正在读的一行留给下一次读取
+func (c *Context) ReadLine(prompt string) (string, error) {
+	if prompt != "" {
+		if _, err := fmt.Fprint(c.Stdout(), prompt); err != nil {
+			return "", err
+		}
+	}
+
+	var line string
+	var err error
+	if h := c.interp; h != nil {
+		// 多次读取之间共用缓冲，避免丢失已读入缓冲区的内容
+		if h.stdinReader == nil {
+			h.stdinReader = bufio.NewReader(c.Stdin())
+		}
+		line, err = h.readLine()
+	} else {
+		line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+
+	if err == io.EOF && line == "" {
+		return "", errorf(msgNoMoreInput)
+	}
+	if err != nil && err != io.EOF {
+		if isFatal(err) {
+			return "", err
+		}
+		return "", errorf(msgReadInput, err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// 后台读取的一行
+type readResult struct {
+	line string
+	err  error
+}
+
+// 读取一行。执行可以被取消时在后台读取，这样超时不会被阻塞在输入上
+func (h *HerCodeInterpreter) readLine() (string, error) {
+	if h.pendingRead == nil {
+		if h.runCtx == nil || h.runCtx.Done() == nil {
+			return h.stdinReader.ReadString('\n')
+		}
+		ch := make(chan readResult, 1)
+		r := h.stdinReader
+		go func() {
+			line, err := r.ReadString('\n')
+			ch <- readResult{line, err}
+		}()
+		h.pendingRead = ch
+	}
+
+	var done <-chan struct{}
+	if h.runCtx != nil {
+		done = h.runCtx.Done()
+	}
+	select {
+	case res := <-h.pendingRead:
+		h.pendingRead = nil
+		return res.line, res.err
+	case <-done:
+		return "", &TimeoutError{Cause: h.runCtx.Err()}
+	}
+}
+
+// 检查本次执行是否已超时或被取消
+func (c *Context) Err() error {
+	if c.interp == nil || c.interp.runCtx == nil {
+		return nil
+	}
+	return c.interp.runCtx.Err()
+}
+
+// 错误信息的语言，为空时使用默认语言
+func (c *Context) language() Lang {
+	if c.interp == nil {
+		return ""
+	}
+	return c.interp.lang
+}
+
+// 是否为新手模式
+func (c *Context) BeginnerMode() bool {
+	return c.interp != nil && c.interp.BeginnerMode
+}
+
 // ==================== 解释器实现 ====================
 
 func (c *Context) GlobalFunc(name string) (*HerCodeFunction, bool) {
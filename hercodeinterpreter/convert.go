@@ -0,0 +1,420 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// ==================== Go 值与 HerCode 值的转换 ====================
+
+var (
+	valueReflectType = reflect.TypeOf(Value{})
+	errorReflectType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// 把 Go 值转换为 HerCode 值。
+// 支持 bool、整数、浮点数、string、error、切片、数组、以字符串为键的 map、函数，
+// 以及指向这些类型的指针；Value 原样返回，nil 转换为空值。
+func ToValue(v any) (Value, error) {
+	if v == nil {
+		return Value{Type: VoidType}, nil
+	}
+	return toValue(reflect.ValueOf(v))
+}
+
+func toValue(rv reflect.Value) (Value, error) {
+	if rv.Type() == valueReflectType {
+		return rv.Interface().(Value), nil
+	}
+	if rv.Type().Implements(errorReflectType) && rv.Kind() != reflect.Interface {
+		if rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return Value{Type: VoidType}, nil
+		}
+		return Value{Type: ErrorType, Error: rv.Interface().(error)}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return Value{Type: BoolType, Bool: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Value{Type: NumberType, Num: float64(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Value{Type: NumberType, Num: float64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return Value{Type: NumberType, Num: rv.Float()}, nil
+	case reflect.String:
+		return Value{Type: StringType, Str: rv.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return Value{Type: VoidType}, nil
+		}
+		return toValue(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return Value{Type: SliceType}, nil
+		}
+		list := make([]Value, rv.Len())
+		for i := range list {
+			item, err := toValue(rv.Index(i))
+			if err != nil {
+				return Value{}, errorf(msgElement, i+1, err)
+			}
+			list[i] = item
+		}
+		return Value{Type: SliceType, Slice: list}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return Value{}, errorf(msgMapKeyType, rv.Type())
+		}
+		m := make(map[string]Value, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			item, err := toValue(iter.Value())
+			if err != nil {
+				return Value{}, errorf(msgMapKey, iter.Key().String(), err)
+			}
+			m[iter.Key().String()] = item
+		}
+		return Value{Type: MapType, Map: m}, nil
+	case reflect.Func:
+		if rv.IsNil() {
+			return Value{Type: VoidType}, nil
+		}
+		b, err := hostBuiltin(rv)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: FunctionType, Host: b}, nil
+	}
+	return Value{}, errorf(msgUnsupportedGoType, rv.Type())
+}
+
+// 把 HerCode 值转换为 Go 值，target 必须是非 nil 指针。
+// 宿主函数和脚本中的函数都可以转换为 Go 函数，函数类型的最后一个返回值必须是 error，调用出错时通过它返回。
+func FromValue(v Value, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errorf(msgFromValueTarget)
+	}
+	return fromValue(v, rv.Elem(), nil)
+}
+
+// 一次宿主函数调用：参数中的函数转换为 Go 函数后，在调用者的上下文中执行，
+// 没有 error 返回值的 Go 函数出错时，错误记录在这里，宿主函数返回后再报告给脚本
+type hostCall struct {
+	ctx *Context
+	err error
+}
+
+func fromValue(v Value, rv reflect.Value, call *hostCall) error {
+	t := rv.Type()
+	if t == valueReflectType {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if t.Kind() == reflect.Interface {
+		if i := v.Interface(); i != nil {
+			iv := reflect.ValueOf(i)
+			if !iv.Type().AssignableTo(t) {
+				return errorf(msgCannotConvert, v.Type, t)
+			}
+			rv.Set(iv)
+		} else {
+			rv.Set(reflect.Zero(t))
+		}
+		return nil
+	}
+
+	mismatch := func() error {
+		return errorf(msgCannotConvert, v.Type, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if v.Type != BoolType {
+			return mismatch()
+		}
+		rv.SetBool(v.Bool)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type != NumberType {
+			return mismatch()
+		}
+		// 先按目标类型的范围比较，超出范围的 float64 转换为整数的结果没有定义
+		limit := math.Ldexp(1, t.Bits()-1)
+		if v.Num != math.Trunc(v.Num) || v.Num < -limit || v.Num >= limit {
+			return errorf(msgNumberOverflow, v.Num, t)
+		}
+		rv.SetInt(int64(v.Num))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Type != NumberType {
+			return mismatch()
+		}
+		if v.Num != math.Trunc(v.Num) || v.Num < 0 || v.Num >= math.Ldexp(1, t.Bits()) {
+			return errorf(msgNumberOverflow, v.Num, t)
+		}
+		rv.SetUint(uint64(v.Num))
+	case reflect.Float32, reflect.Float64:
+		if v.Type != NumberType {
+			return mismatch()
+		}
+		if rv.OverflowFloat(v.Num) {
+			return errorf(msgNumberOverflow, v.Num, t)
+		}
+		rv.SetFloat(v.Num)
+	case reflect.String:
+		if v.Type != StringType {
+			return mismatch()
+		}
+		rv.SetString(v.Str)
+	case reflect.Pointer:
+		if v.Type == VoidType {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		elem := reflect.New(t.Elem())
+		if err := fromValue(v, elem.Elem(), call); err != nil {
+			return err
+		}
+		rv.Set(elem)
+	case reflect.Slice:
+		if v.Type != SliceType {
+			return mismatch()
+		}
+		s := reflect.MakeSlice(t, len(v.Slice), len(v.Slice))
+		for i, item := range v.Slice {
+			if err := fromValue(item, s.Index(i), call); err != nil {
+				return errorf(msgElement, i+1, err)
+			}
+		}
+		rv.Set(s)
+	case reflect.Array:
+		if v.Type != SliceType {
+			return mismatch()
+		}
+		if len(v.Slice) != t.Len() {
+			return errorf(msgListLength, len(v.Slice), t)
+		}
+		for i, item := range v.Slice {
+			if err := fromValue(item, rv.Index(i), call); err != nil {
+				return errorf(msgElement, i+1, err)
+			}
+		}
+	case reflect.Map:
+		if v.Type != MapType {
+			return mismatch()
+		}
+		if t.Key().Kind() != reflect.String {
+			return errorf(msgMapKeyType, t)
+		}
+		m := reflect.MakeMapWithSize(t, len(v.Map))
+		for k, item := range v.Map {
+			elem := reflect.New(t.Elem()).Elem()
+			if err := fromValue(item, elem, call); err != nil {
+				return errorf(msgMapKey, k, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+		}
+		rv.Set(m)
+	case reflect.Func:
+		if v.Type != FunctionType || v.Host == nil && v.Func == nil {
+			return mismatch()
+		}
+		if fn := v.Func; fn != nil && v.Host == nil && !t.IsVariadic() && t.NumIn() != len(fn.Parameters) {
+			return errorf(msgArity, fn.Name, len(fn.Parameters), t.NumIn())
+		}
+		hasErr := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorReflectType
+		if call == nil && !hasErr {
+			return errorf(msgFuncNeedsError, t)
+		}
+		ctx := NewContext(nil)
+		if call != nil {
+			ctx = call.ctx
+		}
+		rv.Set(reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+			if t.IsVariadic() {
+				in = spreadVariadic(in)
+			}
+			args := make([]Value, len(in))
+			for i, arg := range in {
+				args[i], _ = toValue(arg)
+			}
+			result, err := v.call(ctx, args)
+			if err != nil {
+				result = Value{Type: ErrorType, Error: err}
+			}
+			out, err := hostResults(t, result)
+			if err != nil && call != nil && call.err == nil {
+				call.err = err
+			}
+			return out
+		}))
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// 在 ctx 中调用函数值：宿主函数直接调用，脚本中的函数按解释器的执行方式调用
+func (e Value) call(ctx *Context, args []Value) (Value, error) {
+	if e.Host != nil {
+		return e.Host.Call(ctx, args)
+	}
+	if h := ctx.interp; h != nil && h.UseVM && h.program != nil {
+		if proto, ok := h.program.Func(e.Func.Name); ok {
+			return h.callVM(proto, args)
+		}
+	}
+	return callFunction(ctx, e.Func, args)
+}
+
+// MakeFunc 把可变参数作为最后一个切片传入，展开成单独的参数
+func spreadVariadic(in []reflect.Value) []reflect.Value {
+	last := in[len(in)-1]
+	spread := append([]reflect.Value{}, in[:len(in)-1]...)
+	for i := 0; i < last.Len(); i++ {
+		spread = append(spread, last.Index(i))
+	}
+	return spread
+}
+
+// 把 HerCode 值转换为最自然的 Go 值：
+// 数字为 float64，字符串为 string，列表为 []any，字典为 map[string]any，空值为 nil
+func (e Value) Interface() any {
+	switch e.Type {
+	case NumberType:
+		return e.Num
+	case StringType:
+		return e.Str
+	case BoolType:
+		return e.Bool
+	case SliceType:
+		list := make([]any, len(e.Slice))
+		for i, v := range e.Slice {
+			list[i] = v.Interface()
+		}
+		return list
+	case MapType:
+		m := make(map[string]any, len(e.Map))
+		for k, v := range e.Map {
+			m[k] = v.Interface()
+		}
+		return m
+	case FunctionType:
+		if e.Host != nil {
+			return e.Host
+		}
+		return e.Func
+	case ErrorType:
+		return e.Error
+	default:
+		return nil
+	}
+}
+
+// 根据 Go 函数的类型生成内置函数，参数和返回值自动转换。
+// 返回值可以是 ()、(T)、(error) 或 (T, error)。
+func hostBuiltin(fn reflect.Value) (*Builtin, error) {
+	t := fn.Type()
+	switch t.NumOut() {
+	case 0, 1:
+	case 2:
+		if t.Out(1) != errorReflectType {
+			return nil, errorf(msgSecondResult, t)
+		}
+	default:
+		return nil, errorf(msgTooManyResults, t)
+	}
+
+	b := &Builtin{MinArgs: t.NumIn(), Variadic: t.IsVariadic()}
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if b.Variadic && i == t.NumIn()-1 {
+			in = in.Elem()
+			b.MinArgs--
+		}
+		b.Params = append(b.Params, param(fmt.Sprintf("arg%d", i+1), valueTypesOf(in)...))
+	}
+
+	b.Fn = func(ctx *Context, args []Value) (Value, error) {
+		call := &hostCall{ctx: ctx}
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var pt reflect.Type
+			if b.Variadic && i >= t.NumIn()-1 {
+				pt = t.In(t.NumIn() - 1).Elem()
+			} else {
+				pt = t.In(i)
+			}
+			in[i] = reflect.New(pt).Elem()
+			if err := fromValue(arg, in[i], call); err != nil {
+				return Value{}, errorf(msgArg, b.Name, i+1, err)
+			}
+		}
+
+		out := fn.Call(in)
+		if len(out) > 0 && t.Out(len(out)-1) == errorReflectType {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return Value{}, err
+			}
+			out = out[:len(out)-1]
+		}
+		if call.err != nil {
+			return Value{}, call.err
+		}
+		if len(out) == 0 {
+			return Value{Type: VoidType}, nil
+		}
+		return toValue(out[0])
+	}
+	return b, nil
+}
+
+// Go 类型对应的 HerCode 参数类型，无法确定时返回 nil（任意类型）
+func valueTypesOf(t reflect.Type) []ValueType {
+	if t == valueReflectType {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return []ValueType{BoolType}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return []ValueType{NumberType}
+	case reflect.String:
+		return []ValueType{StringType}
+	case reflect.Slice, reflect.Array:
+		return []ValueType{SliceType}
+	case reflect.Map:
+		return []ValueType{MapType}
+	}
+	return nil
+}
+
+// 把内置函数的调用结果转换为 Go 函数的返回值。
+// Go 函数有 error 返回值时错误通过它返回，否则返回零值和错误，由调用者记录
+func hostResults(t reflect.Type, result Value) ([]reflect.Value, error) {
+	out := make([]reflect.Value, t.NumOut())
+	for i := range out {
+		out[i] = reflect.New(t.Out(i)).Elem()
+	}
+	last := t.NumOut() - 1
+	fail := func(err error) ([]reflect.Value, error) {
+		if last >= 0 && t.Out(last) == errorReflectType {
+			out[last].Set(reflect.ValueOf(&err).Elem())
+			return out, nil
+		}
+		return out, err
+	}
+	if result.Type == ErrorType {
+		return fail(result.Error)
+	}
+	if t.NumOut() > 0 && t.Out(0) != errorReflectType {
+		if err := fromValue(result, out[0], nil); err != nil {
+			out[0] = reflect.New(t.Out(0)).Elem()
+			return fail(err)
+		}
+	}
+	return out, nil
+}
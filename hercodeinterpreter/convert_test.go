@@ -0,0 +1,180 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func number(n float64) Value {
+	return Value{Type: NumberType, Num: n}
+}
+
+// 数字转换为 Go 的整数和浮点数：超出范围、不是整数、NaN 和无穷大时返回错误，而不是得到回绕的值
+func TestFromValueNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		num    float64
+		target any // 指向目标类型零值的指针
+		want   any // nil 表示应该出错
+	}{
+		{42, new(int), 42},
+		{-128, new(int8), int8(-128)},
+		{127, new(int8), int8(127)},
+		{128, new(int8), nil},
+		{-129, new(int8), nil},
+		{1.5, new(int), nil},
+		{-(1 << 63), new(int64), int64(math.MinInt64)},
+		{1 << 63, new(int64), nil},
+		{1e19, new(int64), nil},
+		{-1e19, new(int64), nil},
+		{math.NaN(), new(int64), nil},
+		{math.Inf(1), new(int), nil},
+		{math.Inf(-1), new(int32), nil},
+
+		{255, new(uint8), uint8(255)},
+		{256, new(uint8), nil},
+		{-1, new(uint), nil},
+		{1 << 63, new(uint64), uint64(1 << 63)},
+		{1 << 64, new(uint64), nil},
+		{1e20, new(uint64), nil},
+		{math.NaN(), new(uint32), nil},
+		{math.Inf(1), new(uint64), nil},
+
+		{0.5, new(float32), float32(0.5)},
+		{1e39, new(float32), nil},
+		{-1e39, new(float32), nil},
+		{math.Inf(1), new(float32), float32(math.Inf(1))},
+		{1e308, new(float64), 1e308},
+		{math.Inf(-1), new(float64), math.Inf(-1)},
+	} {
+		err := FromValue(number(tc.num), tc.target)
+		got := reflect.ValueOf(tc.target).Elem()
+		switch {
+		case tc.want == nil && err == nil:
+			t.Errorf("FromValue(%v, %s) = %v, want an error", tc.num, got.Type(), got)
+		case tc.want != nil && err != nil:
+			t.Errorf("FromValue(%v, %s): %v", tc.num, got.Type(), err)
+		case tc.want != nil && got.Interface() != tc.want:
+			t.Errorf("FromValue(%v, %s) = %v, want %v", tc.num, got.Type(), got, tc.want)
+		}
+	}
+
+	var f float64
+	if err := FromValue(number(math.NaN()), &f); err != nil || !math.IsNaN(f) {
+		t.Errorf("FromValue(NaN, float64) = %v, %v, want NaN", f, err)
+	}
+}
+
+// 宿主函数和脚本中的函数都可以转换为 Go 函数
+func TestFromValueFuncs(t *testing.T) {
+	h := NewHerCodeInterpreter()
+	if err := h.Parse("function double x:\n    return x * 2\nend\n\nfunction fail x:\n    return x + true\nend\n"); err != nil {
+		t.Fatal(err)
+	}
+	script := func(name string) Value {
+		fn, ok := h.GlobalCtx.GetFunc(name)
+		if !ok {
+			t.Fatalf("no function %s", name)
+		}
+		return Value{Type: FunctionType, Func: fn}
+	}
+	host, err := ToValue(func(a, b float64) float64 { return a - b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ToValue(func(nums ...float64) float64 {
+		total := 0.0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var double func(float64) (float64, error)
+	if err := FromValue(script("double"), &double); err != nil {
+		t.Fatalf("FromValue(double): %v", err)
+	}
+	if got, err := double(21); got != 42 || err != nil {
+		t.Errorf("double(21) = %v, %v, want 42", got, err)
+	}
+
+	var fail func(float64) (float64, error)
+	if err := FromValue(script("fail"), &fail); err != nil {
+		t.Fatalf("FromValue(fail): %v", err)
+	}
+	if _, err := fail(1); err == nil {
+		t.Error("fail(1) returned no error")
+	}
+
+	var sub func(float64, float64) (float64, error)
+	if err := FromValue(host, &sub); err != nil {
+		t.Fatalf("FromValue(host): %v", err)
+	}
+	if got, err := sub(5, 3); got != 2 || err != nil {
+		t.Errorf("sub(5, 3) = %v, %v, want 2", got, err)
+	}
+
+	var total func(...float64) (float64, error)
+	if err := FromValue(sum, &total); err != nil {
+		t.Fatalf("FromValue(sum): %v", err)
+	}
+	if got, err := total(1, 2, 3); got != 6 || err != nil {
+		t.Errorf("total(1, 2, 3) = %v, %v, want 6", got, err)
+	}
+
+	for name, tc := range map[string]struct {
+		v      Value
+		target any
+	}{
+		"wrong arity":     {script("double"), new(func(float64, float64) (float64, error))},
+		"no error result": {script("double"), new(func(float64) float64)},
+		"not a function":  {number(1), new(func() error)},
+		"empty function":  {Value{Type: FunctionType}, new(func() error)},
+	} {
+		if err := FromValue(tc.v, tc.target); err == nil {
+			t.Errorf("%s: FromValue succeeded", name)
+		}
+	}
+}
+
+// 宿主函数的参数是 Go 函数时，脚本中的函数在脚本的上下文中执行，两种执行方式相同
+func TestHostCallsScriptFunction(t *testing.T) {
+	const src = `function double x:
+    return x * 2
+end
+
+start:
+    say apply(f, 21)
+    say apply(f, "x")
+end
+`
+	for _, vm := range []bool{false, true} {
+		var out, errOut bytes.Buffer
+		h := NewHerCodeInterpreter(WithStdout(&out), WithStderr(&errOut), WithVM(vm))
+		if err := h.SetGlobal("apply", func(f func(any) any, x any) any { return f(x) }); err != nil {
+			t.Fatal(err)
+		}
+		// f 要等 Parse 定义了 double 之后才能设置，所以 Parse 先报告 f 未定义，设置后再 Resolve
+		var undefined ResolveErrors
+		if err := h.Parse(src); !errors.As(err, &undefined) {
+			t.Fatalf("Parse = %v, want f reported as undefined", err)
+		}
+		fn, _ := h.GlobalCtx.GetFunc("double")
+		if err := h.SetGlobal("f", Value{Type: FunctionType, Func: fn}); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Resolve(); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		h.Execute(context.Background())
+		if out.String() != "42\n" || h.PrintedErrors() != 1 {
+			t.Errorf("vm=%v: output = %q with %d errors, want 42 and one error\nstderr:\n%s", vm, out.String(), h.PrintedErrors(), errOut.String())
+		}
+	}
+}
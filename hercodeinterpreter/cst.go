@@ -0,0 +1,339 @@
+package hercodeinterpreter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ==================== 具体语法树 ====================
+// Parse 在解析之前就去掉了注释，得到的语法树无法还原出源代码。ParseTree 得到的具体语法树（CST）
+// 保留源代码的每一个字符：注释、空行、缩进和关键字原来的写法（例如“如果”）都在树中，
+// String() 可以原样还原出源代码。格式化、文档生成、重构等工具都可以在它的基础上实现。
+//
+// 树的每个节点对应一行（语句、注释或空行）或一个块（function、start、if、while），
+// 块的节点记录开头的一行、块中的节点、else 行和结束的一行。语句同时给出 Parse 得到的语法树。
+
+// 节点的种类
+type NodeKind int
+
+const (
+	BlankNode   NodeKind = iota // 空行
+	CommentNode                 // 只有注释的一行
+	StmtNode                    // 一条语句
+	FuncNode                    // function ... end
+	StartNode                   // start: ... end
+	IfNode                      // if ... [else ...] endif
+	WhileNode                   // while ... endwhile
+)
+
+// 源代码中的一行，各部分连起来就是原来的一行
+type SourceLine struct {
+	Num     int    // 行号，从 1 开始
+	Indent  string // 行首的空白
+	Code    string // 代码，关键字保持原来的写法
+	Space   string // 代码与注释之间的空白
+	Comment string // 注释，包括开头的 #
+	Tail    string // 行末的空白（包括 \r）
+}
+
+func (l *SourceLine) String() string {
+	return l.Indent + l.Code + l.Space + l.Comment + l.Tail
+}
+
+// 具体语法树的节点
+type Node struct {
+	Kind    NodeKind
+	Line    *SourceLine // 语句所在的行，或者块开头的一行
+	Keyword string      // 第一行开头的关键字，已经翻译为英文（例如 if），不以关键字开头时为空
+	Stmt    Statement   // StmtNode、IfNode、WhileNode 的语法树，IfNode 和 WhileNode 中只有条件
+	Name    string      // FuncNode 的函数名
+	Params  []string    // FuncNode 的参数
+	Err     error       // 这一行的语法错误
+
+	Children     []*Node     // 块中的节点；IfNode 中是 then 分支
+	Else         *SourceLine // IfNode 的 else 行
+	ElseChildren []*Node     // IfNode 的 else 分支
+	End          *SourceLine // 结束块的一行（end、endif、endwhile），没有结束时为 nil
+}
+
+// 是否为块
+func (n *Node) IsBlock() bool {
+	return n.Kind >= FuncNode
+}
+
+// 块的最后一行的行号，不是块或块没有结束时为最后一个子节点的行号
+func (n *Node) LastLine() int {
+	switch {
+	case n.End != nil:
+		return n.End.Num
+	case len(n.ElseChildren) > 0:
+		return n.ElseChildren[len(n.ElseChildren)-1].LastLine()
+	case n.Else != nil:
+		return n.Else.Num
+	case len(n.Children) > 0:
+		return n.Children[len(n.Children)-1].LastLine()
+	}
+	return n.Line.Num
+}
+
+// 具体语法树
+type SyntaxTree struct {
+	Nodes        []*Node
+	FinalNewline bool    // 源代码以换行结尾
+	Errors       []error // 所有的语法错误，包括块的结构错误
+}
+
+// 还原出源代码
+func (t *SyntaxTree) String() string {
+	var lines []string
+	t.Inspect(func(n *Node) bool {
+		lines = append(lines, n.Line.String())
+		return true
+	}, func(l *SourceLine) {
+		lines = append(lines, l.String())
+	})
+	s := strings.Join(lines, "\n")
+	if t.FinalNewline {
+		s += "\n"
+	}
+	return s
+}
+
+// 按源代码的顺序遍历树：每个节点调用 node，node 返回 false 时不进入块的内部；
+// 块的 else 行和结束行调用 line，line 可以为 nil
+func (t *SyntaxTree) Inspect(node func(n *Node) bool, line func(l *SourceLine)) {
+	inspectNodes(t.Nodes, node, line)
+}
+
+func inspectNodes(nodes []*Node, node func(n *Node) bool, line func(l *SourceLine)) {
+	for _, n := range nodes {
+		if !node(n) || !n.IsBlock() {
+			continue
+		}
+		inspectNodes(n.Children, node, line)
+		if n.Else != nil && line != nil {
+			line(n.Else)
+		}
+		inspectNodes(n.ElseChildren, node, line)
+		if n.End != nil && line != nil {
+			line(n.End)
+		}
+	}
+}
+
+// 所有的语法错误合成一个，没有错误时为 nil
+func (t *SyntaxTree) Err() error {
+	return joinErrors(t.Errors...)
+}
+
+// 把源代码解析为具体语法树。有语法错误时仍然返回完整的树，错误记录在出错的节点和 Errors 中。
+// 与 Parse 一样，endif 也能结束 while、endwhile 也能结束 if，这不算语法错误，由 Lint 提醒
+func (h *HerCodeInterpreter) ParseTree(src string) (*SyntaxTree, error) {
+	aliases, err := h.keywordAliases()
+	if err != nil {
+		return nil, h.localize(err)
+	}
+
+	t := &SyntaxTree{}
+	var texts []string // 空的源代码没有任何行
+	if src != "" {
+		texts = strings.Split(src, "\n")
+	}
+	if len(texts) > 0 && texts[len(texts)-1] == "" {
+		texts = texts[:len(texts)-1]
+		t.FinalNewline = true
+	}
+
+	var stack []*Node // 还没有结束的块
+	add := func(n *Node) {
+		if len(stack) == 0 {
+			t.Nodes = append(t.Nodes, n)
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.Else != nil {
+			top.ElseChildren = append(top.ElseChildren, n)
+		} else {
+			top.Children = append(top.Children, n)
+		}
+	}
+	fail := func(n *Node, err error) {
+		if n != nil && n.Err == nil {
+			n.Err = err
+		}
+		t.Errors = append(t.Errors, err)
+	}
+	// 块没有结束就遇到了 end、下一个函数或文件结尾
+	unclosed := func(n *Node) {
+		switch n.Kind {
+		case IfNode:
+			fail(n, errorf(msgIfNotClosed, n.Line.Num))
+		case WhileNode:
+			fail(n, errorf(msgWhileNotClosed, n.Line.Num))
+		default:
+			fail(n, errorf(msgFuncNotClosed, n.Name))
+		}
+	}
+	closeAll := func() {
+		for i := len(stack) - 1; i >= 0; i-- {
+			unclosed(stack[i])
+		}
+		stack = nil
+	}
+
+	for i, text := range texts {
+		line := splitSourceLine(text, i+1)
+		code := strings.TrimSpace(translateKeywords(line.Code, aliases))
+		n := &Node{Kind: StmtNode, Line: line, Keyword: leadingKeyword(code)}
+
+		switch {
+		case line.Code == "" && line.Comment == "":
+			n.Kind = BlankNode
+			add(n)
+
+		case line.Code == "":
+			n.Kind = CommentNode
+			add(n)
+
+		case n.Keyword == "function":
+			closeAll()
+			n.Kind = FuncNode
+			n.Name, n.Params, n.Err = parseFunctionDefinition(code, line.Num)
+			if n.Err != nil {
+				fail(nil, errorf(msgAtLine, line.Num, n.Err))
+			}
+			add(n)
+			stack = append(stack, n)
+
+		case n.Keyword == "start":
+			closeAll()
+			n.Kind, n.Name = StartNode, "start"
+			add(n)
+			stack = append(stack, n)
+
+		case n.Keyword == "end":
+			// 先结束没有结束的 if 和 while，再结束函数
+			for len(stack) > 0 && !isFuncNode(stack[len(stack)-1]) {
+				unclosed(stack[len(stack)-1])
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				add(n) // 多余的 end，Parse 也会忽略它
+				continue
+			}
+			stack[len(stack)-1].End = line
+			stack = stack[:len(stack)-1]
+
+		case n.Keyword == "else":
+			top := topBlock(stack)
+			if top == nil || top.Kind != IfNode || top.Else != nil {
+				id := msgElseWithoutIf
+				if top != nil && top.Kind == WhileNode {
+					id = msgElseNotAfterIf
+				}
+				fail(n, errorf(id, line.Num))
+				add(n)
+				continue
+			}
+			top.Else = line
+
+		case n.Keyword == "endif", n.Keyword == "endwhile":
+			top := topBlock(stack)
+			if top == nil {
+				id := msgEndifWithoutIf
+				if n.Keyword == "endwhile" {
+					id = msgEndwhileWithoutWhile
+				}
+				fail(n, errorf(id, line.Num))
+				add(n)
+				continue
+			}
+			top.End = line
+			stack = stack[:len(stack)-1]
+
+		default:
+			stmt, err := parseStatement(code, line.Num)
+			if err != nil {
+				fail(n, errorf(msgAtLine, line.Num, err))
+				add(n)
+				continue
+			}
+			n.Stmt = stmt
+			add(n)
+			switch stmt.(type) {
+			case *IfStmt:
+				n.Kind = IfNode
+				stack = append(stack, n)
+			case *WhileStmt:
+				n.Kind = WhileNode
+				stack = append(stack, n)
+			}
+		}
+	}
+	closeAll()
+
+	for _, err := range t.Errors {
+		h.localize(err)
+	}
+	t.Inspect(func(n *Node) bool {
+		h.localize(n.Err)
+		return true
+	}, nil)
+	return t, t.Err()
+}
+
+// 把一行拆成缩进、代码、注释和行末空白
+func splitSourceLine(text string, num int) *SourceLine {
+	l := &SourceLine{Num: num}
+	rest := strings.TrimLeftFunc(text, unicode.IsSpace)
+	l.Indent = text[:len(text)-len(rest)]
+
+	codePart := cleanComment(rest)
+	l.Code = strings.TrimRightFunc(codePart, unicode.IsSpace)
+	l.Space = codePart[len(l.Code):]
+	comment := rest[len(codePart):]
+	l.Comment = strings.TrimRightFunc(comment, unicode.IsSpace)
+	l.Tail = comment[len(l.Comment):]
+	if l.Comment == "" {
+		l.Space, l.Tail = "", l.Space+l.Tail
+	}
+	return l
+}
+
+// 翻译成英文关键字之后的代码开头的关键字，判断的规则与 Parse 相同
+func leadingKeyword(code string) string {
+	switch {
+	case strings.HasPrefix(code, "function "):
+		return "function"
+	case strings.HasPrefix(code, "start:"):
+		return "start"
+	case strings.HasPrefix(code, "else"):
+		return "else"
+	case strings.HasPrefix(code, "endif"):
+		return "endif"
+	case strings.HasPrefix(code, "endwhile"):
+		return "endwhile"
+	case code == "end":
+		return "end"
+	}
+	word, _, found := strings.Cut(code, " ")
+	switch word {
+	case "if", "while", "say", "var", "return", "ask":
+		if found {
+			return word
+		}
+	}
+	return ""
+}
+
+func isFuncNode(n *Node) bool {
+	return n.Kind == FuncNode || n.Kind == StartNode
+}
+
+// 最里层的 if 或 while，不在 if 或 while 中时为 nil
+func topBlock(stack []*Node) *Node {
+	if len(stack) == 0 || isFuncNode(stack[len(stack)-1]) {
+		return nil
+	}
+	return stack[len(stack)-1]
+}
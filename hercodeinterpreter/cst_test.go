@@ -0,0 +1,29 @@
+package hercodeinterpreter
+
+import "testing"
+
+// ParseTree 之后 String 还原出完全相同的源代码
+func TestSyntaxTreeRoundTrip(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"\n",
+		"\n\n",
+		"start:\nend",
+		"start:\n    say 1\nend\n",
+		"start:\r\n    say 1  # 注释\r\nend\r\n",
+		"start:\r\n    say 1\r\nend",
+		"start:\nend\n\n\n",
+		"# 只有注释",
+		"start:\n    if true\n        say 1\n    else\n\tsay 2\n    endif\n",
+		"start:\n    say (\nend\n",
+	} {
+		// 有语法错误时也返回完整的树
+		tree, err := NewHerCodeInterpreter().ParseTree(src)
+		if tree == nil {
+			t.Fatalf("ParseTree(%q): %v", src, err)
+		}
+		if got := tree.String(); got != src {
+			t.Errorf("ParseTree(%q).String() = %q", src, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package hercodeinterpreter
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// ==================== 方言文件 ====================
+// 老师可以不重新编译，用一个 JSON 文件把 HerCode 翻译成其他语言（日语、西班牙语、粤语俚语……）：
+//
+//	{
+//	  "name": "es",
+//	  "keywords": {"if": ["si"], "else": ["sino"], "say": ["decir"]},
+//	  "builtins": {"len": ["longitud"], "upper": ["mayusculas"]}
+//	}
+//
+// keywords 的键必须是关键字，builtins 的键必须是内置函数名，别名必须是合法的名字，
+// 不能与关键字或内置函数同名，同一个别名也不能对应两个不同的名字。
+// 内置函数包括宿主程序注册的函数，所以与内置函数有关的检查在使用语言包的解释器中进行。
+
+// 读取并检查方言文件，不检查与内置函数有关的部分
+func LoadLanguagePack(path string) (*LanguagePack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLanguagePack(data)
+}
+
+// 解析并检查 JSON 格式的方言，不检查与内置函数有关的部分
+func ParseLanguagePack(data []byte) (*LanguagePack, error) {
+	var pack LanguagePack
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return nil, errorf(msgDialectJSON, err)
+	}
+	if err := pack.validate(nil); err != nil {
+		return nil, err
+	}
+	return &pack, nil
+}
+
+// 检查语言包：关键字和内置函数是否存在、别名是否合法、有没有冲突。
+// 内置函数按默认的内置函数表检查；解释器使用语言包时按它自己的函数表检查，包括宿主程序注册的函数
+func (p *LanguagePack) Validate() error {
+	return p.validate(defaultBuiltins)
+}
+
+// 按内置函数表 builtins 检查语言包，builtins 为 nil 时不检查与内置函数有关的部分
+func (p *LanguagePack) validate(builtins map[string]*Builtin) error {
+	isKeyword := map[string]bool{}
+	for _, k := range keywords {
+		isKeyword[k] = true
+	}
+
+	seen := map[string]string{} // 别名 → 对应的名字
+	check := func(name string, aliases []string) error {
+		for _, alias := range aliases {
+			switch {
+			case !isIdent(alias):
+				return errorf(msgDialectBadAlias, p.Name, alias)
+			case isKeyword[alias] || builtins[alias] != nil:
+				return errorf(msgDialectAliasIsName, p.Name, alias)
+			}
+			if old, ok := seen[alias]; ok && old != name {
+				return errorf(msgAliasConflict, alias, old, name)
+			}
+			seen[alias] = name
+		}
+		return nil
+	}
+
+	// 按名字排序，出错时每次报告同一个问题
+	for _, name := range sortedKeys(p.Keywords) {
+		if !isKeyword[name] {
+			return errorf(msgDialectUnknownKeyword, p.Name, name)
+		}
+		if err := check(name, p.Keywords[name]); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(p.Builtins) {
+		if builtins != nil && builtins[name] == nil {
+			return errorf(msgDialectUnknownBuiltin, p.Name, name)
+		}
+		if err := check(name, p.Builtins[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// 语言包按解释器自己的函数表检查，宿主程序注册的函数也可以起别名
+func TestLanguagePackUsesInterpreterBuiltins(t *testing.T) {
+	pack, err := ParseLanguagePack([]byte(`{"name": "es", "builtins": {"shout": ["gritar"]}}`))
+	if err != nil {
+		t.Fatalf("ParseLanguagePack: %v", err)
+	}
+	if err := pack.Validate(); err == nil {
+		t.Error("Validate accepted an alias for a function that is not a default built-in")
+	}
+
+	var out bytes.Buffer
+	h := NewHerCodeInterpreter(WithLanguagePacks(pack), WithStdout(&out))
+	h.RegisterFunc("shout", shout)
+	if err := h.Parse("start:\n    say gritar(\"hola\")\nend\n"); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	mustExecute(t, h)
+	if got := out.String(); got != "HOLA\n" {
+		t.Errorf("output = %q, want %q", got, "HOLA\n")
+	}
+
+	// 没有注册 shout 的解释器不认识这个语言包
+	err = NewHerCodeInterpreter(WithLanguagePacks(pack)).Parse("start:\nend\n")
+	if err == nil || !strings.Contains(err.Error(), "shout") {
+		t.Errorf("Parse without shout = %v, want an error about shout", err)
+	}
+}
+
+// 别名不能与解释器中注册的函数同名
+func TestLanguagePackAliasIsRegisteredFunc(t *testing.T) {
+	pack := &LanguagePack{Name: "x", Builtins: map[string][]string{"upper": {"shout"}}}
+	if err := pack.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	h := NewHerCodeInterpreter(WithLanguagePacks(pack))
+	h.RegisterFunc("shout", shout)
+	if err := h.Parse("start:\nend\n"); err == nil {
+		t.Error("Parse accepted the alias shout although shout is a registered function")
+	}
+}
@@ -0,0 +1,104 @@
+package hercodeinterpreter
+
+import "context"
+
+// ==================== Go 嵌入接口 ====================
+
+// 由 Go 宿主程序提供给 HerCode 脚本调用的函数
+type HostFunc func(args ...Value) (Value, error)
+
+// 注册一个宿主函数，脚本中可以像内置函数一样调用它，参数不做类型检查。
+// 应该在 Parse 之前注册，否则 Parse 的名字检查会报告函数未定义，这时可以注册后再调用 Resolve
+func (h *HerCodeInterpreter) RegisterFunc(name string, fn HostFunc) {
+	h.RegisterBuiltin(&Builtin{
+		Name:     name,
+		Params:   []Param{param("args")},
+		Variadic: true,
+		Fn: func(ctx *Context, args []Value) (Value, error) {
+			return fn(args...)
+		},
+	})
+}
+
+// 设置全局变量，v 可以是 Value，也可以是 ToValue 支持的任意 Go 值。
+// Go 函数会被注册为同名的宿主函数，参数和返回值自动转换。
+// 与 RegisterFunc 一样应该在 Parse 之前设置，否则需要设置后再调用 Resolve。
+func (h *HerCodeInterpreter) SetGlobal(name string, v any) (err error) {
+	defer func() { err = h.localize(err) }()
+	val, err := ToValue(v)
+	if err != nil {
+		return errorf(msgGlobalVar, name, err)
+	}
+	if val.Type == FunctionType && val.Host != nil {
+		val.Host.Name = name
+		h.RegisterBuiltin(val.Host)
+		return nil
+	}
+	h.GlobalCtx.SetVar(name, val)
+	return nil
+}
+
+// 最近一次执行（Execute、Call 或 Eval）中 say 输出到错误输出的错误个数。
+// 这些错误不会中断执行，也不会由 Execute 返回，宿主程序可以用它判断脚本是否出过错
+func (h *HerCodeInterpreter) PrintedErrors() int {
+	return h.run.printedErrors
+}
+
+// 读取全局变量
+func (h *HerCodeInterpreter) GetGlobal(name string) (Value, bool) {
+	return h.GlobalCtx.GetVar(name)
+}
+
+// 调用脚本中定义的函数（或内置函数），返回函数的返回值。
+// args 可以是 Value，也可以是 ToValue 支持的任意 Go 值。
+// 脚本只需 Parse 一次，之后可以反复调用，全局变量在多次调用之间保留。
+// ctx 超时或被取消时停止执行并返回 *TimeoutError，超出资源限制时返回 *LimitError。
+func (h *HerCodeInterpreter) Call(ctx context.Context, name string, args ...any) (_ Value, err error) {
+	defer func() { err = h.localize(err) }()
+	if err := ctx.Err(); err != nil {
+		return Value{}, &TimeoutError{Func: name, Cause: err}
+	}
+	defer h.beginRun(ctx)()
+
+	values := make([]Value, len(args))
+	for i, arg := range args {
+		v, err := ToValue(arg)
+		if err != nil {
+			return Value{}, errorf(msgArg, name, i+1, err)
+		}
+		values[i] = v
+	}
+
+	var result Value
+	if fn, ok := h.GlobalCtx.GetFunc(name); ok {
+		if len(values) != len(fn.Parameters) {
+			return Value{}, errorf(msgArity, name, len(fn.Parameters), len(values))
+		}
+		var err error
+		if h.UseVM {
+			var prog *Program
+			if prog, err = h.Program(); err != nil {
+				return Value{}, err
+			}
+			proto, _ := prog.Func(name)
+			result, err = h.callVM(proto, values)
+		} else {
+			result, err = callFunction(h.GlobalCtx, fn, values)
+		}
+		if err != nil {
+			return Value{}, err
+		}
+	} else if b, ok := h.Builtins[name]; ok {
+		var err error
+		if result, err = b.Call(h.GlobalCtx, values); err != nil {
+			return Value{}, err
+		}
+	} else {
+		return Value{}, errorf(msgUndefinedFunc, name, "")
+	}
+
+	if result.Type == ErrorType {
+		return Value{}, result.Error
+	}
+	return result, nil
+}
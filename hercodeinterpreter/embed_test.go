@@ -0,0 +1,74 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const greetScript = `start:
+    say shout(prefix + "hi")
+end
+`
+
+func shout(args ...Value) (Value, error) {
+	return ToValue(strings.ToUpper(args[0].Str))
+}
+
+// 宿主函数和全局变量在 Parse 之前注册时，名字检查可以找到它们
+func TestRegisterBeforeParse(t *testing.T) {
+	var out bytes.Buffer
+	h := NewHerCodeInterpreter(WithStdout(&out))
+	h.RegisterFunc("shout", shout)
+	if err := h.SetGlobal("prefix", "oh "); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Parse(greetScript); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	mustExecute(t, h)
+	if got := out.String(); got != "OH HI\n" {
+		t.Errorf("output = %q, want %q", got, "OH HI\n")
+	}
+}
+
+// Parse 之后才注册的名字先被报告为未定义，注册完后 Resolve 重新检查
+func TestRegisterAfterParse(t *testing.T) {
+	var out bytes.Buffer
+	h := NewHerCodeInterpreter(WithStdout(&out))
+	err := h.Parse(greetScript)
+	var errs ResolveErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Parse = %v, want ResolveErrors for shout and prefix", err)
+	}
+
+	h.RegisterFunc("shout", shout)
+	if err := h.Resolve(); err == nil {
+		t.Fatal("Resolve succeeded with prefix still undefined")
+	}
+	if err := h.SetGlobal("prefix", "oh "); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Resolve(); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	mustExecute(t, h)
+	if got := out.String(); got != "OH HI\n" {
+		t.Errorf("output = %q, want %q", got, "OH HI\n")
+	}
+}
+
+func mustExecute(t *testing.T, h *HerCodeInterpreter) {
+	t.Helper()
+	vals, errs := h.Execute(context.Background())
+	for i, err := range errs {
+		if err == nil && i < len(vals) && vals[i].Type == ErrorType {
+			err = vals[i].Error
+		}
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package hercodeinterpreter
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ==================== 交互式执行 ====================
+// REPL 一段一段地执行代码：函数定义保存在全局上下文中，其余的语句像 start 中的语句一样在全局上下文中执行，
+// 变量在多次执行之间保留。一段代码只有一个表达式时返回它的值。
+
+// 代码中是否还有没结束的函数、start、if 或 while，REPL 据此决定是否继续读取下一行
+func (h *HerCodeInterpreter) Incomplete(src string) bool {
+	aliases, _ := h.keywordAliases()
+	depth := 0
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(translateKeywords(cleanComment(line), aliases))
+		switch {
+		case strings.HasPrefix(line, "function "), strings.HasPrefix(line, "start:"),
+			strings.HasPrefix(line, "if "), strings.HasPrefix(line, "while "):
+			depth++
+		case strings.HasPrefix(line, "endif"), strings.HasPrefix(line, "endwhile"):
+			depth--
+		case line == "end":
+			// end 结束整个函数，函数中没结束的块由 Parse 报告
+			depth = 0
+		}
+	}
+	return depth > 0
+}
+
+// 在全局上下文中执行一段代码。
+// 函数定义中的问题会作为错误返回，但函数仍然会被定义，这样可以先定义调用者、再定义被调用的函数。
+func (h *HerCodeInterpreter) Eval(ctx context.Context, src string) (_ Value, err error) {
+	defer func() { err = h.localize(err) }()
+	aliases, err := h.keywordAliases()
+	if err != nil {
+		return Value{}, err
+	}
+
+	// 只有一行而且是表达式：计算并返回它的值
+	if src = strings.TrimSpace(src); !strings.Contains(src, "\n") {
+		if expr := h.replExpression(translateKeywords(cleanComment(src), aliases)); expr != nil {
+			if err := ctx.Err(); err != nil {
+				return Value{}, &TimeoutError{Cause: err}
+			}
+			defer h.beginRun(ctx)()
+			val, err := expr.Eval(h.GlobalCtx)
+			if err == nil && val.Type == ErrorType {
+				err = val.Error
+			}
+			return val, err
+		}
+	}
+
+	hasStmts, err := h.parseSnippet(src, aliases)
+	if err != nil || !hasStmts {
+		return Value{Type: VoidType}, err
+	}
+	vals, errs := h.Execute(ctx)
+	for _, val := range vals {
+		if val.Error != nil {
+			errs = append(errs, val.Error)
+		}
+	}
+	return Value{Type: VoidType}, joinErrors(errs...)
+}
+
+// 解析一段可以省略 start: 的代码，例如命令行中 -e 后面的代码：
+// 函数定义保存在全局上下文中，其余的语句（包括 start 块中的语句）成为 start 函数，之后用 Execute 执行
+func (h *HerCodeInterpreter) ParseSnippet(src string) (err error) {
+	defer func() { err = h.localize(err) }()
+	aliases, err := h.keywordAliases()
+	if err != nil {
+		return err
+	}
+	_, err = h.parseSnippet(src, aliases)
+	return err
+}
+
+// 函数定义和其余的语句分开解析，保持原来的行号；没有函数定义以外的语句时不修改 start
+func (h *HerCodeInterpreter) parseSnippet(src string, aliases map[string]string) (hasStmts bool, err error) {
+	lines := strings.Split(src, "\n")
+	defs := make([]string, len(lines))
+	stmts := make([]string, len(lines))
+	var defined []string
+	inFunc, inStart := false, false
+	for i, line := range lines {
+		t := strings.TrimSpace(translateKeywords(cleanComment(line), aliases))
+		switch {
+		case inFunc:
+			defs[i] = line
+			inFunc = t != "end"
+		case strings.HasPrefix(t, "function "):
+			defs[i] = line
+			inFunc = true
+			if name, _, err := parseFunctionDefinition(t, i+1); err == nil {
+				defined = append(defined, name)
+			}
+		case strings.HasPrefix(t, "start:"):
+			// :load 的脚本中 start 里的语句直接执行
+			inStart = true
+		case inStart && t == "end":
+			inStart = false
+		default:
+			stmts[i] = line
+		}
+	}
+
+	if len(defined) > 0 || inFunc {
+		if err := h.parse(strings.Join(defs, "\n"), 1); err != nil {
+			if err = onlyIn(err, defined); err != nil {
+				return false, err
+			}
+		}
+	}
+	if strings.TrimSpace(strings.Join(stmts, "")) == "" {
+		return false, nil
+	}
+
+	// start: 是第 0 行，语句保持原来的行号
+	if err := h.parse("start:\n"+strings.Join(stmts, "\n")+"\nend", 0); err != nil {
+		if err = onlyIn(err, []string{"start"}); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// 一行代码是否为表达式：关键字开头的语句、赋值等返回 nil。
+// 只有一个名字时，如果它是函数而不是变量，当作不带参数的函数调用。
+func (h *HerCodeInterpreter) replExpression(line string) Expression {
+	for _, k := range keywords {
+		if line == k || strings.HasPrefix(line, k+" ") {
+			return nil
+		}
+	}
+	expr, err := parseExpression(line, 1)
+	if err != nil {
+		return nil
+	}
+	if ref, ok := expr.(*VarRefExpr); ok {
+		if _, isVar := h.GlobalCtx.GetVar(ref.Name); !isVar {
+			_, isFunc := h.GlobalCtx.GetFunc(ref.Name)
+			_, isBuiltin := h.Builtins[ref.Name]
+			if isFunc || isBuiltin {
+				return &FuncCallExpr{Name: ref.Name, Line: 1}
+			}
+		}
+	}
+	return expr
+}
+
+// 只保留 funcs 中的函数的名字解析错误：之前定义的函数中的问题已经报告过了
+func onlyIn(err error, funcs []string) error {
+	var errs ResolveErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	var kept ResolveErrors
+	for _, e := range errs {
+		for _, fn := range funcs {
+			if e.Func == fn {
+				kept = append(kept, e)
+				break
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
@@ -0,0 +1,86 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 与 examples/compare.sh 相同的输入，examples/ask.hc 会读取它们
+const examplesInput = "小红\n18\n没有了\n"
+
+// 树遍历解释器和字节码虚拟机运行 examples 下的每个脚本，输出必须完全相同
+func TestExamplesSameOnBothEngines(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.hc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scripts in ../examples")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := runExample(string(b), strings.HasSuffix(file, "_test.hc"), false)
+			vm := runExample(string(b), strings.HasSuffix(file, "_test.hc"), true)
+			if tree != vm {
+				t.Errorf("outputs differ\n--- tree-walking interpreter\n%s\n--- virtual machine\n%s", tree, vm)
+			}
+			if tree == "" {
+				t.Errorf("no output")
+			}
+		})
+	}
+}
+
+// 运行脚本，返回输出和错误信息。测试文件和 hercode test 一样依次调用 test 开头的函数
+func runExample(src string, isTest, vm bool) string {
+	var out bytes.Buffer
+	h := NewHerCodeInterpreter(
+		WithStdout(&out),
+		WithStderr(&out),
+		WithStdin(strings.NewReader(examplesInput)),
+		WithVM(vm),
+	)
+	if err := h.Parse(src); err != nil {
+		fmt.Fprintf(&out, "parse error: %v\n", err)
+		return out.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if isTest {
+		var tests []*HerCodeFunction
+		for name, fn := range h.GlobalCtx.Functions {
+			if strings.HasPrefix(name, "test") && len(fn.Parameters) == 0 {
+				tests = append(tests, fn)
+			}
+		}
+		sort.Slice(tests, func(i, j int) bool { return tests[i].Line < tests[j].Line })
+		for _, fn := range tests {
+			_, err := h.Call(ctx, fn.Name)
+			fmt.Fprintf(&out, "%s: %v\n", fn.Name, err)
+		}
+		return out.String()
+	}
+
+	vals, errs := h.Execute(ctx)
+	for i, err := range errs {
+		if i < len(vals) && vals[i].Error != nil {
+			fmt.Fprintf(&out, "runtime error: %v\n", vals[i].Error)
+		}
+		if err != nil {
+			fmt.Fprintf(&out, "runtime error: %v\n", err)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,279 @@
+package hercodeinterpreter
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ==================== 代码格式化 ====================
+// hercode fmt 把脚本整理成统一的格式：
+//   - function、start、if、while 中的语句缩进 4 个空格，else、endif、endwhile、end 与块的第一行对齐
+//   - 运算符两边各一个空格，逗号后面一个空格，括号内侧没有空格
+//   - 连续几行的行尾注释对齐到同一列，注释本身的内容不变
+//   - 行末的空白被删除，连续的空行只保留一行
+//
+// 缩进按 ParseTree 得到的块结构计算。每一行先按语法解析，重新排列空白之后再解析一次，语法树不同时保留原来的写法，
+// 所以格式化不会改变脚本的意思；格式化的结果再格式化一次不会有变化。
+// 字符串中的 # 不是注释，与 cleanComment 的规则相同；关键字保留原来的写法，中文关键字不会变成英文。
+
+const indentUnit = "    "
+
+// 格式化后的一行
+type fmtLine struct {
+	indent  int
+	code    string // 代码部分，为空时是空行或整行注释
+	comment string // 注释，包括开头的 #
+}
+
+// 格式化脚本。脚本有语法错误时返回错误，未定义的名字等问题不影响格式化
+func (h *HerCodeInterpreter) Format(src string) (_ string, err error) {
+	defer func() { err = h.localize(err) }()
+	check := NewHerCodeInterpreter(WithLanguagePacks(h.LanguagePacks...))
+	if err := check.Parse(src); err != nil {
+		var resolveErrs ResolveErrors
+		if !errors.As(err, &resolveErrs) {
+			return "", err
+		}
+	}
+	aliases, err := h.keywordAliases()
+	if err != nil {
+		return "", err
+	}
+	// Parse 不检查函数外面的代码，这里的错误不影响格式化
+	tree, _ := h.ParseTree(src)
+
+	var lines []fmtLine
+	add := func(l *SourceLine, depth int) {
+		if l.Code == "" && l.Comment == "" {
+			// 连续的空行只保留一行，文件开头的空行删除
+			if len(lines) > 0 && lines[len(lines)-1] != (fmtLine{}) {
+				lines = append(lines, fmtLine{})
+			}
+			return
+		}
+		lines = append(lines, fmtLine{indent: depth, code: formatCode(l.Code, aliases, l.Num), comment: l.Comment})
+	}
+	// 块中的节点多缩进一层，else 和结束的一行与块的第一行对齐
+	var walk func(nodes []*Node, depth int)
+	walk = func(nodes []*Node, depth int) {
+		for _, n := range nodes {
+			if isFuncNode(n) {
+				depth = 0
+			}
+			add(n.Line, depth)
+			if !n.IsBlock() {
+				continue
+			}
+			walk(n.Children, depth+1)
+			if n.Else != nil {
+				add(n.Else, depth)
+				walk(n.ElseChildren, depth+1)
+			}
+			if n.End != nil {
+				add(n.End, depth)
+			}
+		}
+	}
+	walk(tree.Nodes, 0)
+	for len(lines) > 0 && lines[len(lines)-1] == (fmtLine{}) {
+		lines = lines[:len(lines)-1]
+	}
+
+	return writeFmtLines(lines), nil
+}
+
+// 输出格式化后的各行，连续几行的行尾注释对齐
+func writeFmtLines(lines []fmtLine) string {
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		// 连续的、既有代码又有注释的行为一组
+		j, col := i, 0
+		for j < len(lines) && lines[j].code != "" && lines[j].comment != "" {
+			col = max(col, displayWidth(strings.Repeat(indentUnit, lines[j].indent)+lines[j].code))
+			j++
+		}
+		if j == i {
+			j = i + 1
+		}
+
+		for _, l := range lines[i:j] {
+			text := l.code
+			if l.code != "" && l.comment != "" {
+				text += strings.Repeat(" ", col-displayWidth(strings.Repeat(indentUnit, l.indent)+l.code)+1)
+				text += l.comment
+			} else if l.comment != "" {
+				text = l.comment
+			}
+			if text != "" {
+				b.WriteString(strings.Repeat(indentUnit, l.indent))
+				b.WriteString(text)
+			}
+			b.WriteString("\n")
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// 重新排列一行代码中的空白。解析结果与原来不同时返回原来的代码
+func formatCode(code string, aliases map[string]string, lineNum int) string {
+	tokens := tokenize(code)
+	var b strings.Builder
+	for i, tok := range tokens {
+		if i > 0 && spaceBetween(tokens, i, aliases) {
+			b.WriteString(" ")
+		}
+		b.WriteString(tok)
+	}
+	out := b.String()
+	if out == code {
+		return code
+	}
+	before, err1 := lineSyntax(code, aliases, lineNum)
+	after, err2 := lineSyntax(out, aliases, lineNum)
+	if err1 != nil || err2 != nil || before != after {
+		return code
+	}
+	return out
+}
+
+// 一行代码的语法树，用于比较格式化前后的意思是否相同
+func lineSyntax(code string, aliases map[string]string, lineNum int) (string, error) {
+	code = strings.TrimSpace(translateKeywords(code, aliases))
+	var b strings.Builder
+	switch {
+	case strings.HasPrefix(code, "function "):
+		name, params, err := parseFunctionDefinition(code, lineNum)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("function " + name + "(" + strings.Join(params, ", ") + ")")
+	case code == "end", strings.HasPrefix(code, "start:"), strings.HasPrefix(code, "else"),
+		strings.HasPrefix(code, "endif"), strings.HasPrefix(code, "endwhile"):
+		b.WriteString(code)
+	default:
+		stmt, err := parseStatement(code, lineNum)
+		if err != nil {
+			return "", err
+		}
+		writeNode(&b, 0, stmt)
+	}
+	return b.String(), nil
+}
+
+// 把一行代码切分成单词、数字、字符串、运算符和标点
+func tokenize(code string) []string {
+	var tokens []string
+	runes := []rune(code)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		j := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '"':
+			// 字符串到下一个没有转义的引号为止
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(runes))
+		case r >= '0' && r <= '9':
+			for j < len(runes) && (isIdentContinue(runes[j]) || runes[j] == '.') {
+				j++
+			}
+		case isIdentContinue(r):
+			for j < len(runes) && isIdentContinue(runes[j]) {
+				j++
+			}
+		case strings.ContainsRune("=!<>", r) && j < len(runes) && runes[j] == '=':
+			j++
+		}
+		tokens = append(tokens, string(runes[i:j]))
+		i = j
+	}
+	return tokens
+}
+
+// 二元运算符和赋值
+func isOperator(tok string) bool {
+	switch tok {
+	case "==", "!=", "<=", ">=", "<", ">", "=", "+", "-", "*", "/", "%":
+		return true
+	}
+	return false
+}
+
+// tokens[i] 前面是否需要一个空格
+func spaceBetween(tokens []string, i int, aliases map[string]string) bool {
+	prev, tok := tokens[i-1], tokens[i]
+	switch {
+	case tok == "," || tok == ")" || tok == ":" || tok == "：":
+		return false
+	case prev == "(":
+		return false
+	case prev == ",":
+		return true
+	case tok == "(":
+		// 函数名和括号之间没有空格，say (x) 这样关键字后面的括号保留空格
+		return !isWord(prev) || isKeyword(prev, aliases)
+	case isUnary(tokens, i-1, aliases):
+		return false
+	}
+	return true
+}
+
+// tokens[i] 是否为一元的正负号，例如 x = -1 中的 -
+func isUnary(tokens []string, i int, aliases map[string]string) bool {
+	if tokens[i] != "-" && tokens[i] != "+" {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	prev := tokens[i-1]
+	return isOperator(prev) || prev == "(" || prev == "," || isKeyword(prev, aliases)
+}
+
+// 是否为单词（名字、关键字或数字）
+func isWord(tok string) bool {
+	r := []rune(tok)[0]
+	return isIdentContinue(r)
+}
+
+// 是否为关键字或关键字的别名
+func isKeyword(tok string, aliases map[string]string) bool {
+	if alias, ok := aliases[tok]; ok {
+		tok = alias
+	}
+	for _, k := range keywords {
+		if tok == k {
+			return true
+		}
+	}
+	return false
+}
+
+// 字符串在等宽字体中的显示宽度，中文等全角字符占两列
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		if isWide(r) {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r >= 0x3000 && r <= 0x303f || // 中文标点
+		r >= 0xff01 && r <= 0xff60 || // 全角字符
+		r >= 0x1f300 && r <= 0x1faff // emoji
+}
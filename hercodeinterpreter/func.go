@@ -1,9 +1,6 @@
 package hercodeinterpreter
 
-import (
-	"fmt"
-	"strings"
-)
+import "strings"
 
 // cleanComment 函数用于清理字符串中的注释。
 // 该函数接受一个字符串作为输入，返回清理掉注释后的字符串。
@@ -86,13 +83,43 @@ func cleanQuotes(s string) string {
 	return s[start:end]
 }
 
+// 判断 s[i] 处的引号是否未被转义（前面有偶数个反斜杠）
+func isUnescapedQuote(s string, i int) bool {
+	slashCount := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		slashCount++
+	}
+	return slashCount%2 == 0
+}
+
+// 判断是否为一个完整的字符串字面量（首尾引号之间没有未转义的引号）
+func isStringLiteral(s string) bool {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return false
+	}
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '"' && isUnescapedQuote(s, i) {
+			return false
+		}
+	}
+	return isUnescapedQuote(s, len(s)-1)
+}
+
 // 辅助函数：分割参数
 func splitArguments(argsStr string) []string {
 	var args []string
 	var current strings.Builder
 	parenDepth := 0
+	insideQuotes := false
 
-	for _, r := range argsStr {
+	for i, r := range argsStr {
+		if r == '"' && isUnescapedQuote(argsStr, i) {
+			insideQuotes = !insideQuotes
+		}
+		if insideQuotes && r != '"' {
+			current.WriteRune(r)
+			continue
+		}
 		switch r {
 		case '(':
 			parenDepth++
@@ -124,9 +151,17 @@ func splitByOperator(exprStr, op string) []string {
 	var parts []string
 	var current strings.Builder
 	parenDepth := 0
+	insideQuotes := false
 
 	for i := 0; i < len(exprStr); i++ {
 		c := exprStr[i]
+		if c == '"' && isUnescapedQuote(exprStr, i) {
+			insideQuotes = !insideQuotes
+		}
+		if insideQuotes || c == '"' {
+			current.WriteByte(c)
+			continue
+		}
 		switch c {
 		case '(':
 			parenDepth++
@@ -160,13 +195,13 @@ func parseFunctionDefinition(line string, linenumber int) (string, []string, err
 
 	colonIndex := strings.Index(line, ":")
 	if colonIndex == -1 {
-		return "", nil, fmt.Errorf("%d 行，函数定义缺少冒号", linenumber)
+		return "", nil, errorf(msgFuncMissingColon, linenumber)
 	}
 	line = strings.TrimSuffix(line, ":")
 
 	// 检查是否是函数定义
 	if !strings.HasPrefix(line, "function ") {
-		return "", nil, fmt.Errorf("%d 行，不是函数定义", linenumber)
+		return "", nil, errorf(msgNotFuncDef, linenumber)
 	}
 
 	// 移除 function 关键字
@@ -175,11 +210,14 @@ func parseFunctionDefinition(line string, linenumber int) (string, []string, err
 	// 分割函数名和参数
 	parts := strings.Fields(line)
 	if len(parts) == 0 {
-		return "", nil, fmt.Errorf("%d 行，函数定义格式错误", linenumber)
+		return "", nil, errorf(msgBadFuncDef, linenumber)
 	}
 
 	// 函数名是第一个部分
 	funcName := parts[0]
+	if !isIdent(funcName) {
+		return "", nil, errorf(msgBadName, linenumber, funcName)
+	}
 
 	// 参数是剩余部分（直到冒号）
 	var params []string
@@ -188,10 +226,16 @@ func parseFunctionDefinition(line string, linenumber int) (string, []string, err
 			// 处理结尾的冒号
 			param := strings.TrimSuffix(parts[i], ":")
 			if param != "" {
+				if !isIdent(param) {
+					return "", nil, errorf(msgBadName, linenumber, param)
+				}
 				params = append(params, param)
 			}
 			break
 		}
+		if !isIdent(parts[i]) {
+			return "", nil, errorf(msgBadName, linenumber, parts[i])
+		}
 		params = append(params, parts[i])
 	}
 
@@ -0,0 +1,472 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// ==================== 字节码文件（.hcb） ====================
+// 文件格式（整数均为小端序）：
+//
+//	魔数     4 字节  "HCB\x1a"
+//	版本     2 字节  BytecodeVersion
+//	长度     4 字节  正文的字节数
+//	校验和   4 字节  正文的 CRC-32（IEEE）
+//	正文     编译后的程序，变长整数编码
+//
+// 修改正文的编码方式或指令的含义时必须增加 BytecodeVersion。
+
+const (
+	bytecodeMagic      = "HCB\x1a"
+	bytecodeHeaderSize = 14
+
+	// 字节码文件格式的版本
+	BytecodeVersion = 1
+)
+
+// 字节码文件的错误，可以用 errors.Is 区分
+var (
+	ErrNotBytecode     error = msgError(msgNotBytecode)
+	ErrBytecodeVersion error = msgError(msgBytecodeVersion)
+	ErrBytecodeCorrupt error = msgError(msgBytecodeCorrupt)
+)
+
+// 检查字节码文件的魔数、版本和校验和，返回正文
+func CheckBytecode(data []byte) ([]byte, error) {
+	if len(data) < bytecodeHeaderSize || string(data[:4]) != bytecodeMagic {
+		return nil, ErrNotBytecode
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != BytecodeVersion {
+		return nil, errorf(msgVersionMismatch, ErrBytecodeVersion, v, BytecodeVersion)
+	}
+	size := binary.LittleEndian.Uint32(data[6:])
+	body := data[bytecodeHeaderSize:]
+	if uint32(len(body)) != size {
+		return nil, errorf(msgBadLength, ErrBytecodeCorrupt, size, len(body))
+	}
+	if sum := binary.LittleEndian.Uint32(data[10:]); crc32.ChecksumIEEE(body) != sum {
+		return nil, errorf(msgChecksum, ErrBytecodeCorrupt)
+	}
+	return body, nil
+}
+
+// 把编译后的程序编码为字节码文件
+func EncodeProgram(p *Program) []byte {
+	var e encoder
+	e.uint(uint64(len(p.Funcs)))
+	for _, fn := range p.Funcs {
+		e.proto(fn)
+	}
+	e.uint(uint64(len(p.Start)))
+	for _, proto := range p.Start {
+		e.proto(proto)
+	}
+
+	header := make([]byte, bytecodeHeaderSize)
+	copy(header, bytecodeMagic)
+	binary.LittleEndian.PutUint16(header[4:], BytecodeVersion)
+	binary.LittleEndian.PutUint32(header[6:], uint32(len(e.buf)))
+	binary.LittleEndian.PutUint32(header[10:], crc32.ChecksumIEEE(e.buf))
+	return append(header, e.buf...)
+}
+
+// 解码字节码文件，检查格式并验证每条指令的操作数
+func DecodeProgram(data []byte) (*Program, error) {
+	body, err := CheckBytecode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{r: bytes.NewReader(body)}
+	p := &Program{}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		p.Funcs = append(p.Funcs, d.proto())
+	}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		p.Start = append(p.Start, d.proto())
+	}
+	if d.err == nil && d.r.Len() > 0 {
+		d.err = errorf(msgTrailingData, d.r.Len())
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBytecodeCorrupt, d.err)
+	}
+	if err := p.verify(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBytecodeCorrupt, err)
+	}
+	return p, nil
+}
+
+// 常量的类型标记
+const (
+	constVoid byte = iota
+	constNumber
+	constString
+	constBool
+)
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(n uint64) {
+	e.buf = binary.AppendUvarint(e.buf, n)
+}
+
+func (e *encoder) int(n int64) {
+	e.buf = binary.AppendVarint(e.buf, n)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) str(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strs(list []string) {
+	e.uint(uint64(len(list)))
+	for _, s := range list {
+		e.str(s)
+	}
+}
+
+func (e *encoder) proto(p *Proto) {
+	e.str(p.Name)
+	e.uint(uint64(p.Params))
+	e.strs(p.Locals)
+	e.uint(uint64(p.NumSlots))
+	e.bool(p.Global)
+
+	e.uint(uint64(len(p.Code)))
+	for i, in := range p.Code {
+		e.buf = append(e.buf, byte(in.Op))
+		e.int(int64(in.A))
+		e.int(int64(in.B))
+		e.int(int64(p.Handlers[i]))
+	}
+
+	e.uint(uint64(len(p.Consts)))
+	for _, v := range p.Consts {
+		switch v.Type {
+		case NumberType:
+			e.buf = append(e.buf, constNumber)
+			e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v.Num))
+		case StringType:
+			e.buf = append(e.buf, constString)
+			e.str(v.Str)
+		case BoolType:
+			e.buf = append(e.buf, constBool)
+			e.bool(v.Bool)
+		default:
+			e.buf = append(e.buf, constVoid)
+		}
+	}
+
+	e.strs(p.Names)
+
+	e.uint(uint64(len(p.Loops)))
+	for _, loop := range p.Loops {
+		e.int(int64(loop.Line))
+		e.strs(loop.Vars)
+		e.bool(loop.Pure)
+		e.bool(loop.NeverChanges)
+		e.uint(uint64(loop.Slot))
+	}
+}
+
+// 解码器，遇到第一个错误后停止读取
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = errorf(msgTruncated)
+	}
+	return n
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = errorf(msgTruncated)
+	}
+	return n
+}
+
+// 读取元素个数，不能超过剩余的字节数
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(d.r.Len()) {
+		if d.err == nil {
+			d.err = errorf(msgTooManyElements, n)
+		}
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.err = errorf(msgTruncated)
+	}
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *decoder) str() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = errorf(msgTruncated)
+	}
+	return string(b)
+}
+
+func (d *decoder) strs() []string {
+	var list []string
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		list = append(list, d.str())
+	}
+	return list
+}
+
+func (d *decoder) proto() *Proto {
+	p := &Proto{}
+	p.Name = d.str()
+	p.Params = int(d.uint())
+	p.Locals = d.strs()
+	p.NumSlots = int(d.uint())
+	p.Global = d.bool()
+
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		op := Opcode(d.byte())
+		a, b := int32(d.int()), int32(d.int())
+		p.Code = append(p.Code, Instr{Op: op, A: a, B: b})
+		p.Handlers = append(p.Handlers, int32(d.int()))
+	}
+
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		switch kind := d.byte(); kind {
+		case constNumber:
+			var bits [8]byte
+			if _, err := io.ReadFull(d.r, bits[:]); err != nil && d.err == nil {
+				d.err = errorf(msgTruncated)
+			}
+			p.Consts = append(p.Consts, Value{Type: NumberType, Num: math.Float64frombits(binary.LittleEndian.Uint64(bits[:]))})
+		case constString:
+			p.Consts = append(p.Consts, Value{Type: StringType, Str: d.str()})
+		case constBool:
+			p.Consts = append(p.Consts, Value{Type: BoolType, Bool: d.bool()})
+		case constVoid:
+			p.Consts = append(p.Consts, Value{Type: VoidType})
+		default:
+			if d.err == nil {
+				d.err = errorf(msgUnknownConstKind, kind)
+			}
+		}
+	}
+
+	p.Names = d.strs()
+
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		p.Loops = append(p.Loops, LoopInfo{
+			Line:         int(d.int()),
+			Vars:         d.strs(),
+			Pure:         d.bool(),
+			NeverChanges: d.bool(),
+			Slot:         int(d.uint()),
+		})
+	}
+	return p
+}
+
+// 检查每条指令的操作数都在范围之内，避免损坏的文件让虚拟机越界
+func (p *Program) verify() error {
+	for _, fn := range p.Funcs {
+		if fn.Global {
+			return errorf(msgFuncNotGlobal, fn.Name)
+		}
+		if err := fn.verify(p); err != nil {
+			return errorf(msgInFunc, fn.Name, err)
+		}
+	}
+	for i, proto := range p.Start {
+		if !proto.Global {
+			return errorf(msgStartNotGlobal, i+1)
+		}
+		if err := proto.verify(p); err != nil {
+			return errorf(msgInStart, i+1, err)
+		}
+	}
+	return nil
+}
+
+func (p *Proto) verify(prog *Program) error {
+	if p.Params > len(p.Locals) || p.NumSlots != len(p.Locals)+len(p.Loops) {
+		return errorf(msgSlotCount)
+	}
+	if len(p.Code) == 0 || p.Code[len(p.Code)-1].Op != OpReturn {
+		return errorf(msgMissingReturn)
+	}
+	for _, loop := range p.Loops {
+		if loop.Slot < len(p.Locals) || loop.Slot >= p.NumSlots {
+			return errorf(msgLoopSlot, loop.Slot)
+		}
+	}
+
+	in := func(i int32, n int) bool { return i >= 0 && int(i) < n }
+	for pc, ins := range p.Code {
+		ok := true
+		switch ins.Op {
+		case OpConst:
+			ok = in(ins.A, len(p.Consts))
+		case OpLoadLocal:
+			ok = in(ins.A, len(p.Locals)) && in(ins.B, len(p.Names)) && !p.Global
+		case OpStoreLocal:
+			ok = in(ins.A, len(p.Locals)) && !p.Global
+		case OpLoadName, OpStoreName, OpCheckFunc, OpAsk:
+			ok = in(ins.A, len(p.Names))
+		case OpCallBuiltin:
+			ok = in(ins.A, len(p.Names)) && ins.B >= 0
+		case OpCall:
+			ok = in(ins.A, len(prog.Funcs)) && ins.B >= 0
+		case OpJump, OpJumpIfFalse:
+			ok = in(ins.A, len(p.Code))
+		case OpLoopInit, OpLoopEnter, OpLoopCheck:
+			ok = in(ins.A, len(p.Loops))
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpNe, OpLt, OpGt, OpLe, OpGe,
+			OpDup, OpStmt, OpSay, OpReturn, OpReturnIfSet:
+		default:
+			return errorf(msgUnknownOpcode, pc, ins.Op)
+		}
+		if !ok {
+			return errorf(msgOperandRange, pc, ins.Op)
+		}
+		if h := p.Handlers[pc]; h < handleAbort || int(h) >= len(p.Code) {
+			return errorf(msgHandlerRange, pc)
+		}
+	}
+	return p.verifyStack()
+}
+
+// 检查每条指令执行时运算数栈上都有足够的值，而且从不同路径到达同一位置时栈的深度相同
+func (p *Proto) verifyStack() error {
+	depth := make([]int, len(p.Code))
+	for i := range depth {
+		depth[i] = -1
+	}
+	var work []int
+	reach := func(pc, d int) error {
+		if depth[pc] == -1 {
+			depth[pc] = d
+			work = append(work, pc)
+		} else if depth[pc] != d {
+			return errorf(msgStackDepth, pc)
+		}
+		return nil
+	}
+	if err := reach(0, 0); err != nil {
+		return err
+	}
+	for _, h := range p.Handlers {
+		if h >= 0 {
+			if err := reach(int(h), 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		ins, d := p.Code[pc], depth[pc]
+
+		need, effect := 0, 0
+		switch ins.Op {
+		case OpConst, OpLoadLocal, OpLoadName:
+			effect = 1
+		case OpDup:
+			need, effect = 1, 1
+		case OpStoreLocal, OpStoreName, OpSay, OpJumpIfFalse, OpReturnIfSet:
+			need, effect = 1, -1
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpNe, OpLt, OpGt, OpLe, OpGe:
+			need, effect = 2, -1
+		case OpCall, OpCallBuiltin:
+			need, effect = int(ins.B), 1-int(ins.B)
+		case OpAsk, OpReturn:
+			need = 1
+		}
+		if d < need {
+			return errorf(msgStackUnderflow, pc, ins.Op)
+		}
+
+		switch ins.Op {
+		case OpReturn:
+			continue
+		case OpJump:
+			if err := reach(int(ins.A), d); err != nil {
+				return err
+			}
+			continue
+		case OpJumpIfFalse:
+			if err := reach(int(ins.A), d+effect); err != nil {
+				return err
+			}
+		}
+		if pc+1 >= len(p.Code) {
+			return errorf(msgNoReturnAfter, pc)
+		}
+		if err := reach(pc+1, d+effect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 载入编译好的程序，之后 Execute 和 Call 都由虚拟机执行。
+// 程序中的函数会替换已经解析的同名函数。
+func (h *HerCodeInterpreter) LoadProgram(p *Program) (err error) {
+	defer func() { err = h.localize(err) }()
+	for _, fn := range p.Funcs {
+		if _, isBuiltin := h.Builtins[fn.Name]; isBuiltin && h.ShadowPolicy == ShadowDeny {
+			return errorf(msgShadowBuiltin, fn.Name)
+		}
+	}
+	for _, fn := range p.Funcs {
+		// 只保留函数名和参数，用于 Call 检查参数个数和 PrintFunctions
+		h.GlobalCtx.SetFunc(fn.Name, &HerCodeFunction{Name: fn.Name, Parameters: fn.Locals[:fn.Params]})
+	}
+	h.program = p
+	h.UseVM = true
+	return nil
+}
@@ -2,7 +2,10 @@ package hercodeinterpreter
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"strings"
 )
@@ -12,47 +15,105 @@ type HerCodeInterpreter struct {
 	Functions    map[string]*HerCodeFunction
 	StartFunc    string
 	GlobalCtx    *Context
+	Builtins     map[string]*Builtin // 内置函数表
+	ShadowPolicy ShadowPolicy        // 用户函数与内置函数同名时的处理策略
+	Stdout       io.Writer           // say 等语句的输出
+	Stderr       io.Writer           // 运行错误的输出
+	Stdin        io.Reader           // 输入
+	stdinReader  *bufio.Reader       // 按行读取 Stdin，多次读取之间共用缓冲
+	pendingRead  chan readResult     // 超时时还没有读完的一行，下次读取时接着等待
+	Limits       Limits              // 资源限制
+	BeginnerMode bool                // 新手模式：检测死循环等常见错误并给出解释
+	UseVM        bool                // 编译成字节码，由虚拟机执行
+	Args         []string            // 命令行参数，脚本中的 args 列表
+	lang         Lang                // 错误信息的语言，为空时使用默认语言
+	program      *Program            // 编译后的字节码，Parse 后失效
+	runCtx       context.Context     // 当前执行的 context，用于超时和取消
+	run          runState            // 当前执行的资源计数
 	funcStack    []*HerCodeFunction
 	blockStack   []Statement
 	currentBlock *Statement // 当前处理的块（if 或 while）
 	inElseBranch bool       // 标记当前是否在 else 分支中
 
+	LanguagePacks []*LanguagePack // 关键字语言包，默认为中文关键字
+}
+
+// 解释器选项
+type Option func(h *HerCodeInterpreter)
+
+// 设置输出，默认为 os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(h *HerCodeInterpreter) { h.Stdout = w }
+}
+
+// 设置错误输出，默认为 os.Stderr
+func WithStderr(w io.Writer) Option {
+	return func(h *HerCodeInterpreter) { h.Stderr = w }
+}
+
+// 设置输入，默认为 os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(h *HerCodeInterpreter) { h.Stdin = r }
+}
+
+// 开启新手模式
+func WithBeginnerMode(on bool) Option {
+	return func(h *HerCodeInterpreter) { h.BeginnerMode = on }
+}
+
+// 设置用户函数与内置函数同名时的处理策略，默认为 ShadowAllow
+func WithShadowPolicy(p ShadowPolicy) Option {
+	return func(h *HerCodeInterpreter) { h.ShadowPolicy = p }
 }
 
 // 创建新解释器
-func NewHerCodeInterpreter() *HerCodeInterpreter {
-	return &HerCodeInterpreter{
+func NewHerCodeInterpreter(opts ...Option) *HerCodeInterpreter {
+	h := &HerCodeInterpreter{
 		Functions: make(map[string]*HerCodeFunction),
 		GlobalCtx: NewContext(nil),
+		Builtins:  make(map[string]*Builtin),
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Stdin:     os.Stdin,
+		Limits:    DefaultLimits,
+
+		LanguagePacks: []*LanguagePack{ChineseKeywords},
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	h.GlobalCtx.interp = h
+	h.GlobalCtx.SetVar("args", argsValue(h.Args))
+	h.registerBuiltinFunctions()
+	return h
 }
 
 // 注册内置函数
 func (h *HerCodeInterpreter) registerBuiltinFunctions() {
-	// len 函数
-	h.GlobalCtx.SetFunc("len", &HerCodeFunction{
-		Name:       "len",
-		Parameters: []string{"str"},
-		ReturnType: NumberType,
-	})
-
-	// substr 函数
-	h.GlobalCtx.SetFunc("substr", &HerCodeFunction{
-		Name:       "substr",
-		Parameters: []string{"str", "start", "end"},
-		ReturnType: StringType,
-	})
-
-	// sqrt 函数
-	h.GlobalCtx.SetFunc("sqrt", &HerCodeFunction{
-		Name:       "sqrt",
-		Parameters: []string{"num"},
-		ReturnType: NumberType,
-	})
+	for name, b := range defaultBuiltins {
+		h.Builtins[name] = b
+	}
+}
+
+// 注册（或替换）一个内置函数
+func (h *HerCodeInterpreter) RegisterBuiltin(b *Builtin) {
+	h.Builtins[b.Name] = b
+}
+
+// 开始一次执行：记录 context 并重置资源计数，返回的函数用于结束执行
+func (h *HerCodeInterpreter) beginRun(ctx context.Context) func() {
+	h.runCtx = ctx
+	h.run = runState{}
+	return func() { h.runCtx = nil }
 }
 
 // 解析HerCode脚本
 func (h *HerCodeInterpreter) Parse(script string) error {
+	return h.localize(h.parse(script, 1))
+}
+
+// 解析脚本，脚本的第一行是第 firstLine 行
+func (h *HerCodeInterpreter) parse(script string, firstLine int) error {
 	scanner := bufio.NewScanner(strings.NewReader(script))
 	currentFunc := ""
 	currentFuncStatements := []Statement{}
@@ -60,6 +121,11 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 	h.funcStack = []*HerCodeFunction{}
 	h.currentBlock = nil
 	h.inElseBranch = false
+	h.program = nil
+	aliases, err := h.keywordAliases()
+	if err != nil {
+		return err
+	}
 	// 正则表达式
 	//funcRegex := regexp.MustCompile(`^function\s+([a-zA-Z_][a-zA-Z0-9_]*)\(([^)]*)\):`)
 	//funcRegex := regexp.MustCompile(`^function\s+([a-zA-Z_][a-zA-Z0-9_]*)\(([^)]*)\)\s*:\s*(.*)`)
@@ -75,7 +141,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 	returnRegex := regexp.MustCompile(`^return\s+(.*)`)
 
 	//endRegex := regexp.MustCompile(`^end`)
-	lineNum := 0
+	lineNum := firstLine - 1
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Text()
@@ -84,7 +150,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 		//}
 		//debug()
 		line = cleanComment(line)
-		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(translateKeywords(line, aliases))
 
 		// 跳过空行和注释
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -96,7 +162,10 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 		if strings.HasPrefix(line, "function ") {
 			funcName, params, err := parseFunctionDefinition(line, lineNum)
 			if err != nil {
-				return fmt.Errorf("行 %d: %v", lineNum, err)
+				return errorf(msgAtLine, lineNum, err)
+			}
+			if _, isBuiltin := h.Builtins[funcName]; isBuiltin && h.ShadowPolicy == ShadowDeny {
+				return errorf(msgAtLine, lineNum, lazyMsg(msgShadowBuiltin, funcName))
 			}
 
 			// 结束之前的函数
@@ -120,6 +189,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 			newFunc := &HerCodeFunction{
 				Name:       funcName,
 				Parameters: params,
+				Line:       lineNum,
 			}
 			h.GlobalCtx.SetFunc(funcName, newFunc)
 			h.funcStack = append(h.funcStack, newFunc)
@@ -133,6 +203,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 			currentFuncStatements = []Statement{}
 			h.GlobalCtx.SetFunc("start", &HerCodeFunction{
 				Name: "start",
+				Line: lineNum,
 			})
 			h.funcStack = append(h.funcStack, h.GlobalCtx.Functions["start"])
 			h.currentBlock = nil
@@ -142,14 +213,14 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 		// 处理else语句 - 关键修复
 		if strings.HasPrefix(line, "else") {
 			if len(h.blockStack) == 0 {
-				return fmt.Errorf("行 %d: else 没有匹配的 if", lineNum)
+				return errorf(msgElseWithoutIf, lineNum)
 			}
 
 			// 获取栈顶元素
 			topStmt := h.blockStack[len(h.blockStack)-1]
 			ifStmt, ok := topStmt.(*IfStmt)
 			if !ok {
-				return fmt.Errorf("行 %d: else 必须紧跟在 if 之后", lineNum)
+				return errorf(msgElseNotAfterIf, lineNum)
 			}
 
 			// 创建新的Else分支
@@ -164,7 +235,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 		// 处理endif语句
 		if strings.HasPrefix(line, "endif") {
 			if len(h.blockStack) == 0 {
-				return fmt.Errorf("行 %极: endif 没有匹配的 if", lineNum)
+				return errorf(msgEndifWithoutIf, lineNum)
 			}
 
 			// 弹出栈顶元素
@@ -197,7 +268,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 
 		if strings.HasPrefix(line, "endwhile") {
 			if len(h.blockStack) == 0 {
-				return fmt.Errorf("行 %d: endwhile 没有匹配的 while", lineNum)
+				return errorf(msgEndwhileWithoutWhile, lineNum)
 			}
 
 			// 弹出栈顶元素
@@ -233,7 +304,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 			exprStr := strings.TrimSpace(matches[1])
 			expr, err := parseExpression(exprStr, lineNum)
 			if err != nil {
-				return fmt.Errorf("行 %d: %v", lineNum, err)
+				return errorf(msgAtLine, lineNum, err)
 			}
 
 			stmt := &ReturnStmt{Expr: expr}
@@ -242,7 +313,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 			if h.currentBlock != nil {
 				switch b := (*h.currentBlock).(type) {
 				case *IfStmt:
-					if len(b.ElseBranch) > 0 {
+					if h.inElseBranch {
 						b.ElseBranch = append(b.ElseBranch, stmt)
 					} else {
 						b.ThenBranch = append(b.ThenBranch, stmt)
@@ -258,6 +329,9 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 
 		// 处理end语句
 		if line == "end" {
+			if len(h.blockStack) > 0 {
+				return unclosedBlockError(h.blockStack[len(h.blockStack)-1], lineNum)
+			}
 			if len(h.funcStack) > 0 {
 				fn := h.funcStack[len(h.funcStack)-1]
 				fn.Statements = currentFuncStatements
@@ -279,7 +353,7 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 		if currentFunc != "" {
 			stmt, err := parseStatement(line, lineNum)
 			if err != nil {
-				return fmt.Errorf("行 %d: %v", lineNum, err)
+				return errorf(msgAtLine, lineNum, err)
 			}
 
 			// 如果语句是控制结构，添加到块堆栈
@@ -314,55 +388,89 @@ func (h *HerCodeInterpreter) Parse(script string) error {
 	}
 
 	if len(h.funcStack) > 0 {
-		return fmt.Errorf("函数 %s 未结束", h.funcStack[0].Name)
+		return errorf(msgFuncNotClosed, h.funcStack[0].Name)
+	}
+
+	// 运行之前检查未定义的变量和函数，有问题时返回 ResolveErrors，脚本仍然已经解析完毕
+	return h.resolve()
+}
+
+// 函数结束时还有没结束的 if 或 while。拼错的 endif / endwhile 会被当成函数调用放进块的最后，
+// 这时指出拼错的那一行
+func unclosedBlockError(block Statement, lineNum int) error {
+	var body []Statement
+	keyword, notClosed := "endif", msgIfNotClosed
+	switch b := block.(type) {
+	case *IfStmt:
+		body = b.ThenBranch
+		if b.ElseBranch != nil {
+			body = b.ElseBranch
+		}
+	case *WhileStmt:
+		body = b.Body
+		keyword, notClosed = "endwhile", msgWhileNotClosed
+	}
+	if n := len(body); n > 0 {
+		if call, ok := body[n-1].(*FuncCallStmt); ok && len(call.Arguments) == 0 && closestName(call.Name, []string{keyword}) != "" {
+			return errorf(msgBadStmt, call.Line, call.Name, lazyMsg(msgDidYouMean, keyword))
+		}
 	}
+	return errorf(notClosed, lineNum)
+}
 
-	return nil
+// 执行HerCode程序，ctx 超时或被取消时停止执行并返回 *TimeoutError，
+// 超出资源限制时停止执行并返回 *LimitError
+func (h *HerCodeInterpreter) Execute(ctx context.Context) ([]Value, []error) {
+	vals, errs := h.execute(ctx)
+	for i := range vals {
+		vals[i].Error = h.localize(vals[i].Error)
+	}
+	for i := range errs {
+		errs[i] = h.localize(errs[i])
+	}
+	return vals, errs
 }
 
-// 执行HerCode程序
-func (h *HerCodeInterpreter) Execute() ([]Value, []error) {
+func (h *HerCodeInterpreter) execute(ctx context.Context) ([]Value, []error) {
 	// 检查入口函数是否存在
 	startFunc, exists := h.GlobalCtx.GetFunc("start")
 	if !exists {
-		return nil, []error{fmt.Errorf("入口函数 start 未定义")}
+		return nil, []error{errorf(msgNoStart)}
 	}
+	if h.UseVM {
+		return h.executeVM(ctx)
+	}
+
+	defer h.beginRun(ctx)()
 
-	//for _, fn := range h.GlobalCtx.Functions {
-	//	fmt.Printf("  函数名: %s\n", fn.Name)
-	//	fmt.Printf("  参数: %v\n", fn.Parameters)
-	//	fmt.Printf("  返回值: %v\n", fn.ReturnType)
-	//	fmt.Println("  函数体:")
-	//	for i, stmt := range fn.Statements {
-	//		fmt.Printf("    %d: %s\n", i+1, stmt)
-	//	}
-	//	fmt.Println()
-	//}
 	var errs []error
 	var vals []Value
 	for _, stmt := range startFunc.Statements {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, &TimeoutError{Cause: err})
+			break
+		}
 		val, err := stmt.Execute(h.GlobalCtx)
 		vals = append(vals, val)
 		errs = append(errs, err)
-
+		if isFatal(err) {
+			break
+		}
 	}
-	// 执行入口函数
-	//_, err := startFunc.Statements[0].Execute(h.GlobalCtx)
-	//return err
 	return vals, errs
 }
 
 // 打印解析的函数信息
 func (h *HerCodeInterpreter) PrintFunctions() {
-	fmt.Println("解析到的函数:")
+	fmt.Fprintln(h.Stdout, "解析到的函数:")
 	for name, fn := range h.GlobalCtx.Functions {
-		fmt.Printf("  函数名: %s\n", name)
-		fmt.Printf("  参数: %v\n", fn.Parameters)
-		fmt.Printf("  返回值: %v\n", fn.ReturnType)
-		fmt.Println("  函数体:")
+		fmt.Fprintf(h.Stdout, "  函数名: %s\n", name)
+		fmt.Fprintf(h.Stdout, "  参数: %v\n", fn.Parameters)
+		fmt.Fprintf(h.Stdout, "  返回值: %v\n", fn.ReturnType)
+		fmt.Fprintln(h.Stdout, "  函数体:")
 		for i, stmt := range fn.Statements {
-			fmt.Printf("    %d: %s\n", i+1, stmt)
+			fmt.Fprintf(h.Stdout, "    %d: %s\n", i+1, stmt)
 		}
-		fmt.Println()
+		fmt.Fprintln(h.Stdout)
 	}
 }
@@ -0,0 +1,601 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ==================== 错误信息 ====================
+// 所有错误信息按种类放在 messages 中，每种都有中文和英文两个版本。
+// 每个解释器可以用 WithLang 选择自己的语言，没有选择时使用 SetLang 设置的默认语言。
+// 新增错误信息时先在下面加一个 msgID，再在 messages 中写上两种语言的格式。
+//
+// errorf 创建的错误在调用 Error 时才生成信息，解释器在 Parse、Execute、Call 等方法返回之前
+// 把错误设置为自己的语言（localize），所以同一个进程中的多个解释器可以使用不同的语言。
+
+// 错误信息的语言
+type Lang string
+
+const (
+	LangZH Lang = "zh"
+	LangEN Lang = "en"
+)
+
+var lang = LangZH
+
+// 设置错误信息的默认语言，默认为中文，没有用 WithLang 选择语言的解释器都使用它。
+// 应在使用解释器之前调用。
+func SetLang(l Lang) {
+	lang = l
+}
+
+// 当前的默认语言
+func CurrentLang() Lang {
+	return lang
+}
+
+// 设置解释器的错误信息使用的语言，不设置时使用 SetLang 设置的默认语言
+func WithLang(l Lang) Option {
+	return func(h *HerCodeInterpreter) { h.lang = l }
+}
+
+// 解释器的错误信息使用的语言，没有用 WithLang 设置时为默认语言
+func (h *HerCodeInterpreter) Lang() Lang {
+	if h.lang == "" {
+		return lang
+	}
+	return h.lang
+}
+
+// 由 --lang 参数或 LANG 环境变量的值得到语言，例如 en、zh、en_US.UTF-8、zh_CN.UTF-8，
+// 不认识时返回中文和 false
+func ParseLang(s string) (Lang, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.HasPrefix(s, "zh"):
+		return LangZH, true
+	case strings.HasPrefix(s, "en"):
+		return LangEN, true
+	}
+	return LangZH, false
+}
+
+// 错误信息的种类
+type msgID int
+
+const (
+	// 解析
+	msgAtLine msgID = iota
+	msgLinePrefix
+	msgEmptyExpr
+	msgParseLeft
+	msgParseRight
+	msgBadExpr
+	msgNotSimpleExpr
+	msgNotFuncCall
+	msgBadCondition
+	msgBadAskPrompt
+	msgBadAssign
+	msgBadVarDecl
+	msgBadCall
+	msgBadName
+	msgBadStmt
+	msgDidYouMean
+	msgFuncMissingColon
+	msgNotFuncDef
+	msgBadFuncDef
+	msgShadowBuiltin
+	msgElseWithoutIf
+	msgElseNotAfterIf
+	msgEndifWithoutIf
+	msgEndwhileWithoutWhile
+	msgIfNotClosed
+	msgWhileNotClosed
+	msgFuncNotClosed
+	msgResolveError
+	msgAliasConflict
+	msgDialectJSON
+	msgDialectUnknownKeyword
+	msgDialectUnknownBuiltin
+	msgDialectBadAlias
+	msgDialectAliasIsName
+
+	// 运行
+	msgNoStart
+	msgUndefinedVar
+	msgUndefinedFunc
+	msgAssignToNonVar
+	msgTypeMismatch
+	msgDivByZero
+	msgModByZero
+	msgUnknownOp
+	msgConditionNotBool
+	msgInfiniteLoop
+	msgLoopIncrement
+	msgLoopFlipBool
+	msgLoopAskAgain
+	msgArity
+	msgAtLeast
+	msgArgType
+	msgArgInt
+	msgArg
+	msgInputNotNumber
+	msgNoMoreInput
+	msgReadInput
+	msgSayError
+
+	// 值的类型
+	msgTypeNumber
+	msgTypeString
+	msgTypeBool
+	msgTypeVoid
+	msgTypeSlice
+	msgTypeMap
+	msgTypeFunction
+	msgTypeError
+	msgTypeUnknown
+	msgListSep
+	msgOr
+
+	// 超时和资源限制
+	msgTimeout
+	msgCanceled
+	msgLoopInterrupted
+	msgCallInterrupted
+	msgStepLimit
+	msgCallDepthLimit
+	msgStringLimit
+	msgCollectionLimit
+	msgOutputLimit
+	msgLimit
+	msgLimitInCall
+
+	// 内置函数
+	msgSqrtNegative
+	msgLogNonPositive
+	msgLogBase
+	msgEmptyList
+	msgEmptyString
+	msgCompareNonNumber
+	msgRandomRange
+	msgRandomTooWide
+	msgSubstrStart
+	msgSubstrEnd
+	msgRepeatNegative
+	msgRepeatTooLarge
+	msgEmptyPad
+	msgPadTooWide
+	msgFormatUnclosed
+	msgFormatBadPlaceholder
+	msgFormatMissingArg
+	msgAssertFailed
+	msgAssertFailedMsg
+	msgExit
+	msgExitCode
+	msgArgMissing
+	msgArgNotNumber
+
+	// 静态检查
+	msgLintDiagnostic
+	msgLintOutsideFunction
+	msgLintEndifClosesWhile
+	msgLintEndwhileClosesIf
+	msgLintUnusedParam
+	msgLintUnusedVar
+	msgLintUnusedFunc
+	msgLintShadowBuiltin
+	msgLintShadowConstant
+	msgLintUseBeforeAssign
+	msgLintUnreachable
+	msgLintIfAlwaysTrue
+	msgLintIfAlwaysFalse
+	msgLintWhileNever
+	msgLintWhileForever
+
+	// Go 嵌入接口
+	msgGlobalVar
+	msgElement
+	msgMapKeyType
+	msgMapKey
+	msgUnsupportedGoType
+	msgFromValueTarget
+	msgCannotConvert
+	msgNumberOverflow
+	msgListLength
+	msgFuncNeedsError
+	msgSecondResult
+	msgTooManyResults
+
+	// 编译和字节码
+	msgCompileFunc
+	msgCompileStart
+	msgUnsupportedStmt
+	msgUnsupportedExpr
+	msgUnknownInstr
+	msgNotBytecode
+	msgBytecodeVersion
+	msgBytecodeCorrupt
+	msgVersionMismatch
+	msgBadLength
+	msgChecksum
+	msgTrailingData
+	msgTruncated
+	msgTooManyElements
+	msgUnknownConstKind
+	msgFuncNotGlobal
+	msgInFunc
+	msgStartNotGlobal
+	msgInStart
+	msgSlotCount
+	msgMissingReturn
+	msgLoopSlot
+	msgUnknownOpcode
+	msgOperandRange
+	msgHandlerRange
+	msgStackDepth
+	msgStackUnderflow
+	msgNoReturnAfter
+)
+
+type message struct {
+	zh, en string
+}
+
+var messages = [...]message{
+	msgAtLine:                {"行 %d: %v", "line %d: %v"},
+	msgLinePrefix:            {"行 %d, ", "line %d, "},
+	msgEmptyExpr:             {"行 %d, 空表达式", "line %d, empty expression"},
+	msgParseLeft:             {"解析左侧表达式失败: %v", "cannot parse the left side: %v"},
+	msgParseRight:            {"解析右侧表达式失败: %v", "cannot parse the right side: %v"},
+	msgBadExpr:               {"行 %d, 无法解析表达式: %s", "line %d, cannot understand expression: %s"},
+	msgNotSimpleExpr:         {"行 %d, 不是简单表达式", "line %d, not a simple expression"},
+	msgNotFuncCall:           {"行 %d, 不是函数调用", "line %d, not a function call"},
+	msgBadCondition:          {"行 %d, 解析条件表达式失败: %v", "line %d, cannot understand the condition: %v"},
+	msgBadAskPrompt:          {"行 %d, 解析 ask 提示失败: %v", "line %d, cannot understand the ask prompt: %v"},
+	msgBadAssign:             {"行 %d, 解析赋值表达式错误: %v", "line %d, cannot understand the assigned value: %v"},
+	msgBadVarDecl:            {"行 %d, 无效的变量声明: %s", "line %d, invalid variable declaration: %s"},
+	msgBadCall:               {"行 %d, 无效的函数调用: %s", "line %d, invalid function call: %s"},
+	msgBadName:               {"行 %d, %s 不是有效的名字：名字要以字母或下划线开头，后面只能是字母、数字或下划线", "line %d, %s is not a valid name: a name starts with a letter or underscore, followed by letters, digits or underscores"},
+	msgBadStmt:               {"行 %d, 无法解析语句: %s%s", "line %d, cannot understand statement: %s%s"},
+	msgDidYouMean:            {"，你是不是想写 %s？", ". Did you mean %s?"},
+	msgFuncMissingColon:      {"行 %d, 函数定义缺少冒号", "line %d, function definition is missing a colon"},
+	msgNotFuncDef:            {"行 %d, 不是函数定义", "line %d, not a function definition"},
+	msgBadFuncDef:            {"行 %d, 函数定义格式错误", "line %d, malformed function definition"},
+	msgShadowBuiltin:         {"函数 %s 与内置函数同名", "function %s has the same name as a built-in function"},
+	msgElseWithoutIf:         {"行 %d: else 没有匹配的 if", "line %d: else without a matching if"},
+	msgElseNotAfterIf:        {"行 %d: else 必须紧跟在 if 之后", "line %d: else must belong to an if"},
+	msgEndifWithoutIf:        {"行 %d: endif 没有匹配的 if", "line %d: endif without a matching if"},
+	msgEndwhileWithoutWhile:  {"行 %d: endwhile 没有匹配的 while", "line %d: endwhile without a matching while"},
+	msgIfNotClosed:           {"行 %d: if 语句还没有结束，请先用 endif 结束", "line %d: the if statement is not finished yet, close it with endif first"},
+	msgWhileNotClosed:        {"行 %d: while 循环还没有结束，请先用 endwhile 结束", "line %d: the while loop is not finished yet, close it with endwhile first"},
+	msgFuncNotClosed:         {"函数 %s 未结束", "function %s is missing its end"},
+	msgResolveError:          {"行 %d: %s（在函数 %s 中）", "line %d: %s (in function %s)"},
+	msgAliasConflict:         {"别名 %s 同时对应 %s 和 %s", "alias %s stands for both %s and %s"},
+	msgDialectJSON:           {"方言文件格式错误: %v", "invalid dialect file: %v"},
+	msgDialectUnknownKeyword: {"方言 %s: %s 不是关键字", "dialect %s: %s is not a keyword"},
+	msgDialectUnknownBuiltin: {"方言 %s: 没有名为 %s 的内置函数", "dialect %s: there is no built-in function named %s"},
+	msgDialectBadAlias:       {"方言 %s: 别名 %s 不是有效的名字", "dialect %s: alias %s is not a valid name"},
+	msgDialectAliasIsName:    {"方言 %s: 别名 %s 与关键字或内置函数同名", "dialect %s: alias %s is already a keyword or built-in function"},
+
+	msgNoStart:          {"入口函数 start 未定义", "the start: entry point is not defined"},
+	msgUndefinedVar:     {"变量未定义: %s%s", "undefined variable: %s%s"},
+	msgUndefinedFunc:    {"函数未定义: %s%s", "undefined function: %s%s"},
+	msgAssignToNonVar:   {"赋值操作左侧必须是变量", "the left side of an assignment must be a variable"},
+	msgTypeMismatch:     {"行 %d, 类型不匹配: %s %s %s", "line %d, type mismatch: %s %s %s"},
+	msgDivByZero:        {"行 %d, 除以零错误", "line %d, division by zero"},
+	msgModByZero:        {"行 %d, 取模运算除以零错误", "line %d, modulo by zero"},
+	msgUnknownOp:        {"未知运算符: %s", "unknown operator: %s"},
+	msgConditionNotBool: {"条件表达式必须为布尔类型", "the condition must be true or false"},
+	msgInfiniteLoop: {
+		"行 %[1]d: 这个 while 循环永远不会结束，循环条件中的 %[2]s 从未改变。请在循环体里修改 %[2]s，例如 %[3]s",
+		"line %[1]d: this while loop never ends, because %[2]s in its condition never changes. Change %[2]s inside the loop, for example %[3]s",
+	},
+	msgLoopIncrement:  {"%[1]s = %[1]s + 1", "%[1]s = %[1]s + 1"},
+	msgLoopFlipBool:   {"%s = %t", "%s = %t"},
+	msgLoopAskAgain:   {`ask "还要继续吗？" into %s`, `ask "Keep going?" into %s`},
+	msgArity:          {"%s() 需要%v个参数，实际传入 %d 个", "%s() expects %v argument(s), but got %d"},
+	msgAtLeast:        {"至少%d", "at least %d"},
+	msgArgType:        {"%s() 第%d个参数 %s 必须是%s，实际是%s", "%s() argument %d (%s) must be a %s, got a %s"},
+	msgArgInt:         {"%s() 第%d个参数必须是整数", "%s() argument %d must be a whole number"},
+	msgArg:            {"%s() 第%d个参数: %v", "%s() argument %d: %v"},
+	msgInputNotNumber: {"输入的 \"%s\" 不是数字，%s 需要一个数字", "the input \"%s\" is not a number, %s needs a number"},
+	msgNoMoreInput:    {"没有更多输入了（已到达输入末尾 EOF）", "no more input (reached end of input, EOF)"},
+	msgReadInput:      {"读取输入失败: %v", "cannot read input: %v"},
+	msgSayError:       {"错误: %v", "error: %v"},
+
+	msgTypeNumber:   {"数字", "number"},
+	msgTypeString:   {"字符串", "string"},
+	msgTypeBool:     {"布尔值", "boolean"},
+	msgTypeVoid:     {"空值", "void"},
+	msgTypeSlice:    {"列表", "list"},
+	msgTypeMap:      {"字典", "dictionary"},
+	msgTypeFunction: {"函数", "function"},
+	msgTypeError:    {"错误", "error"},
+	msgTypeUnknown:  {"未知类型", "unknown type"},
+	msgListSep:      {"、", ", "},
+	msgOr:           {"或", " or "},
+
+	msgTimeout:         {"执行超时", "execution timed out"},
+	msgCanceled:        {"执行被取消", "execution was canceled"},
+	msgLoopInterrupted: {"行 %d: while 循环%s，请检查循环条件是否会变为 false", "line %d: while loop: %s, check whether the loop condition ever becomes false"},
+	msgCallInterrupted: {"调用函数 %[1]s 时%[2]s", "%[2]s while calling function %[1]s"},
+	msgStepLimit:       {"执行步数超出限制", "step limit exceeded"},
+	msgCallDepthLimit:  {"函数调用层数超出限制", "call depth limit exceeded"},
+	msgStringLimit:     {"字符串长度超出限制", "string size limit exceeded"},
+	msgCollectionLimit: {"列表或字典元素个数超出限制", "list or dictionary size limit exceeded"},
+	msgOutputLimit:     {"输出内容超出限制", "output limit exceeded"},
+	msgLimit:           {"%v（上限 %d）", "%v (limit %d)"},
+	msgLimitInCall:     {"%v（上限 %d，调用 %s 时）", "%v (limit %d, while calling %s)"},
+
+	msgSqrtNegative:         {"sqrt() 参数不能为负数", "sqrt() argument cannot be negative"},
+	msgLogNonPositive:       {"log() 参数必须大于 0", "log() argument must be greater than 0"},
+	msgLogBase:              {"log() 底数必须大于 0 且不等于 1", "log() base must be greater than 0 and not equal to 1"},
+	msgEmptyList:            {"%s() 列表不能为空", "%s() list cannot be empty"},
+	msgEmptyString:          {"%s() 字符串不能为空", "%s() string cannot be empty"},
+	msgCompareNonNumber:     {"%s() 只能比较数字，第%d个值是%s", "%s() can only compare numbers, value %d is a %s"},
+	msgRandomRange:          {"random_int() 下限不能大于上限", "random_int() lower bound cannot be greater than upper bound"},
+	msgRandomTooWide:        {"random_int() 范围太大", "random_int() range is too large"},
+	msgSubstrStart:          {"substr() 起始位置超出范围", "substr() start is out of range"},
+	msgSubstrEnd:            {"substr() 结束位置超出范围", "substr() end is out of range"},
+	msgRepeatNegative:       {"repeat() 次数不能为负数", "repeat() count cannot be negative"},
+	msgRepeatTooLarge:       {"repeat() 次数太大", "repeat() count is too large"},
+	msgEmptyPad:             {"%s() 填充字符不能为空", "%s() padding cannot be empty"},
+	msgPadTooWide:           {"%s() 宽度太大，最多 %d 个字符", "%s() width is too large, at most %d characters"},
+	msgFormatUnclosed:       {"format() 模板中的 { 没有闭合", "format() template has an unclosed {"},
+	msgFormatBadPlaceholder: {"format() 无效的占位符: {%s}", "format() invalid placeholder: {%s}"},
+	msgFormatMissingArg:     {"format() 缺少第%d个占位符对应的参数", "format() is missing an argument for placeholder %d"},
+	msgAssertFailed:         {"断言失败", "assertion failed"},
+	msgAssertFailedMsg:      {"断言失败: %s", "assertion failed: %s"},
+	msgExit:                 {"脚本调用 exit(%d) 结束运行", "the script called exit(%d)"},
+	msgExitCode:             {"exit() 退出码必须是 0 到 255 之间的整数", "exit() code must be a whole number from 0 to 255"},
+	msgArgMissing:           {"arg() 没有下标为 %d 的命令行参数", "arg() there is no command-line argument at index %d"},
+	msgArgNotNumber:         {"arg() 下标为 %d 的命令行参数 \"%s\" 不是数字", "arg() the command-line argument \"%[2]s\" at index %[1]d is not a number"},
+
+	msgLintDiagnostic:       {"行 %d: %s [%s]", "line %d: %s [%s]"},
+	msgLintOutsideFunction:  {"这一行不在任何函数中，不会被执行。请把它放进 start: 或某个函数里", "this line is not inside any function, so it never runs. Move it into start: or a function"},
+	msgLintEndifClosesWhile: {"这里想结束第 %d 行的 while 循环，while 要用 endwhile 结束，而不是 endif", "this line closes the while loop from line %d, but a while loop is closed with endwhile, not endif"},
+	msgLintEndwhileClosesIf: {"这里想结束第 %d 行的 if 语句，if 要用 endif 结束，而不是 endwhile", "this line closes the if statement from line %d, but an if statement is closed with endif, not endwhile"},
+	msgLintUnusedParam:      {"参数 %s 在函数 %s 中没有被用到。如果不需要它，可以把它删掉", "parameter %s is never used in function %s. If you do not need it, you can remove it"},
+	msgLintUnusedVar:        {"变量 %s 赋了值，但之后没有被用到。检查一下是不是写错了名字，或者可以把它删掉", "variable %s is given a value but never used. Check the spelling, or remove it if you do not need it"},
+	msgLintUnusedFunc:       {"函数 %s 定义了，但从来没有被调用过", "function %s is defined but never called"},
+	msgLintShadowBuiltin:    {"函数 %[1]s 与内置函数 %[1]s 同名，调用 %[1]s 时会用你的函数，内置的 %[1]s 就用不了了。换一个名字会更清楚", "function %[1]s has the same name as the built-in %[1]s, so calls to %[1]s use your function and the built-in one is hidden. A different name would be clearer"},
+	msgLintShadowConstant:   {"%[1]s 与内置常量 %[1]s 同名，在这里 %[1]s 不再是内置的值。换一个名字会更清楚", "%[1]s has the same name as the built-in constant %[1]s, so here %[1]s no longer means the built-in value. A different name would be clearer"},
+	msgLintUseBeforeAssign:  {"变量 %s 在第 %d 行才赋值，这里还没有值。请先用 var 给它一个值，再使用它", "variable %s only gets a value on line %d, so it has no value here yet. Give it a value with var before using it"},
+	msgLintUnreachable:      {"这一行在 return 之后，永远不会被执行", "this line comes after return, so it never runs"},
+	msgLintIfAlwaysTrue:     {"这个条件总是成立（true），if 里的语句每次都会执行。检查一下是不是写错了变量名或运算符", "this condition is always true, so the if always runs. Check for a misspelled variable or the wrong operator"},
+	msgLintIfAlwaysFalse:    {"这个条件永远不成立（false），if 里的语句永远不会执行。检查一下是不是写错了变量名或运算符", "this condition is always false, so the if never runs. Check for a misspelled variable or the wrong operator"},
+	msgLintWhileNever:       {"这个条件永远不成立（false），循环体一次也不会执行", "this condition is always false, so the loop body never runs"},
+	msgLintWhileForever:     {"这个条件总是成立（true），循环里又没有 return，也没有调用函数（例如 exit），循环永远不会结束", "this condition is always true and the loop has no return and calls no function (such as exit), so it never ends"},
+
+	msgGlobalVar:         {"全局变量 %s: %v", "global variable %s: %v"},
+	msgElement:           {"第%d个元素: %v", "element %d: %v"},
+	msgMapKeyType:        {"字典的键必须是字符串，不支持 %s", "dictionary keys must be strings, %s is not supported"},
+	msgMapKey:            {"键 %s: %v", "key %s: %v"},
+	msgUnsupportedGoType: {"不支持转换 Go 类型 %s", "cannot convert Go type %s"},
+	msgFromValueTarget:   {"FromValue 的 target 必须是非 nil 指针", "FromValue target must be a non-nil pointer"},
+	msgCannotConvert:     {"不能把%s转换为 %s", "cannot convert a %s to %s"},
+	msgNumberOverflow:    {"数字 %v 不能转换为 %s", "number %v cannot be converted to %s"},
+	msgListLength:        {"列表长度为 %d，不能转换为 %s", "list of length %d cannot be converted to %s"},
+	msgFuncNeedsError:    {"%s 没有 error 返回值，无法报告调用中的错误", "%s has no error result to report failed calls"},
+	msgSecondResult:      {"函数 %s 的第二个返回值必须是 error", "the second result of function %s must be error"},
+	msgTooManyResults:    {"函数 %s 最多只能有两个返回值", "function %s can have at most two results"},
+
+	msgCompileFunc:      {"编译函数 %s 失败: %v", "cannot compile function %s: %v"},
+	msgCompileStart:     {"编译 start 失败: %v", "cannot compile start: %v"},
+	msgUnsupportedStmt:  {"不支持的语句: %s", "unsupported statement: %s"},
+	msgUnsupportedExpr:  {"不支持的表达式: %s", "unsupported expression: %s"},
+	msgUnknownInstr:     {"未知的指令: %s", "unknown instruction: %s"},
+	msgNotBytecode:      {"不是 HerCode 字节码文件", "not a HerCode bytecode file"},
+	msgBytecodeVersion:  {"字节码版本不受支持", "unsupported bytecode version"},
+	msgBytecodeCorrupt:  {"字节码文件已损坏", "bytecode file is corrupt"},
+	msgVersionMismatch:  {"%w: 文件版本 %d，当前版本 %d，请用当前版本的 hercode 重新 build", "%w: file version %d, current version %d, rebuild it with this version of hercode"},
+	msgBadLength:        {"%w: 长度应为 %d 字节，实际为 %d 字节", "%w: expected %d bytes, got %d bytes"},
+	msgChecksum:         {"%w: 校验和不匹配", "%w: checksum mismatch"},
+	msgTrailingData:     {"末尾有 %d 字节多余的数据", "%d bytes of trailing data"},
+	msgTruncated:        {"数据不完整", "unexpected end of data"},
+	msgTooManyElements:  {"元素个数 %d 超出文件长度", "element count %d exceeds the file length"},
+	msgUnknownConstKind: {"未知的常量类型 %d", "unknown constant kind %d"},
+	msgFuncNotGlobal:    {"函数 %s 不能是全局代码", "function %s cannot be global code"},
+	msgInFunc:           {"函数 %s: %v", "function %s: %v"},
+	msgStartNotGlobal:   {"start 第%d条语句必须是全局代码", "start statement %d must be global code"},
+	msgInStart:          {"start 第%d条语句: %v", "start statement %d: %v"},
+	msgSlotCount:        {"槽位个数不正确", "wrong number of slots"},
+	msgMissingReturn:    {"缺少 RETURN 指令", "missing RETURN instruction"},
+	msgLoopSlot:         {"循环的槽位 %d 超出范围", "loop slot %d is out of range"},
+	msgUnknownOpcode:    {"第%d条指令: 未知的操作码 %d", "instruction %d: unknown opcode %d"},
+	msgOperandRange:     {"第%d条指令 %s 的操作数超出范围", "instruction %d %s: operand out of range"},
+	msgHandlerRange:     {"第%d条指令的错误处理位置超出范围", "instruction %d: error handler out of range"},
+	msgStackDepth:       {"第%d条指令处的栈深度不一致", "instruction %d: inconsistent stack depth"},
+	msgStackUnderflow:   {"第%d条指令 %s 执行时栈上的值不够", "instruction %d %s: not enough values on the stack"},
+	msgNoReturnAfter:    {"第%d条指令之后没有 RETURN", "no RETURN after instruction %d"},
+}
+
+// 可以按指定的语言生成文字：错误和错误信息中的片段（类型名、建议等）
+type localizer interface {
+	inLang(l Lang) string
+}
+
+// 按语言 l 格式化信息，l 为空时使用默认语言。参数中的 localizer 也按 l 生成
+func format(l Lang, id msgID, args []any) string {
+	if l == "" {
+		l = lang
+	}
+	m := messages[id]
+	f := m.zh
+	if l == LangEN {
+		f = m.en
+	}
+	if len(args) == 0 {
+		return f
+	}
+	local := make([]any, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(localizer); ok {
+			local[i] = t.inLang(l)
+		} else {
+			local[i] = arg
+		}
+	}
+	if id == msgAtLine {
+		// 错误本身已经以同一行的行号开头（例如“行 2, 无法解析表达式”）时不再重复行号
+		text := fmt.Sprint(local[1])
+		if strings.HasPrefix(text, fmt.Sprintf(f, args[0], "")) || strings.HasPrefix(text, format(l, msgLinePrefix, args[:1])) {
+			return text
+		}
+	}
+	return fmt.Sprintf(strings.ReplaceAll(f, "%w", "%v"), local...)
+}
+
+// 按默认语言格式化信息
+func msg(id msgID, args ...any) string {
+	return format("", id, args)
+}
+
+// 按语言生成的一段文字，作为其他信息的参数时使用外层信息的语言
+type lazyText func(l Lang) string
+
+func (t lazyText) String() string {
+	return t("")
+}
+
+func (t lazyText) inLang(l Lang) string {
+	return t(l)
+}
+
+// 按 id 生成的一段文字，语言由使用它的信息决定
+func lazyMsg(id msgID, args ...any) lazyText {
+	return func(l Lang) string {
+		return format(l, id, args)
+	}
+}
+
+// 创建错误，格式中可以使用 %w
+func errorf(id msgID, args ...any) error {
+	return &langError{id: id, args: args}
+}
+
+// errorf 创建的错误，信息在调用 Error 时按 lang 生成，lang 为空时使用默认语言
+type langError struct {
+	id   msgID
+	args []any
+	lang Lang
+}
+
+func (e *langError) Error() string {
+	return format(e.lang, e.id, e.args)
+}
+
+func (e *langError) inLang(l Lang) string {
+	return format(l, e.id, e.args)
+}
+
+func (e *langError) setLang(l Lang) {
+	e.lang = l
+}
+
+// 格式中 %w 对应的参数
+func (e *langError) Unwrap() []error {
+	var errs []error
+	f := messages[e.id].zh
+	n := 0
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(f) && f[i] == '%' {
+			continue
+		}
+		for i < len(f) && strings.IndexByte("+-# 0123456789.", f[i]) >= 0 {
+			i++
+		}
+		if i < len(f) && f[i] == 'w' && n < len(e.args) {
+			if err, ok := e.args[n].(error); ok {
+				errs = append(errs, err)
+			}
+		}
+		n++
+	}
+	return errs
+}
+
+// 多个错误合成的一个错误，每个错误一行
+type errorList []error
+
+func (e errorList) Error() string {
+	return e.inLang("")
+}
+
+func (e errorList) inLang(l Lang) string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = inLang(err, l)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e errorList) Unwrap() []error {
+	return e
+}
+
+// 把错误合成一个，忽略 nil，都是 nil 时返回 nil
+func joinErrors(errs ...error) error {
+	var list errorList
+	for _, err := range errs {
+		if err != nil {
+			list = append(list, err)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+// 按语言 l 生成错误信息，不支持多种语言的错误使用它自己的信息
+func inLang(err error, l Lang) string {
+	if t, ok := err.(localizer); ok {
+		return t.inLang(l)
+	}
+	return err.Error()
+}
+
+// 可以记住语言的错误，之后调用 Error 时使用这种语言
+type langSetter interface {
+	setLang(l Lang)
+}
+
+// 让错误及其包装的错误都使用语言 l。l 为空时什么也不做，错误使用默认语言
+func localize(err error, l Lang) error {
+	if err == nil || l == "" {
+		return err
+	}
+	if s, ok := err.(langSetter); ok {
+		s.setLang(l)
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		localize(u.Unwrap(), l)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			localize(e, l)
+		}
+	}
+	return err
+}
+
+// 让错误使用解释器的语言
+func (h *HerCodeInterpreter) localize(err error) error {
+	return localize(err, h.lang)
+}
+
+// 没有参数的错误，在调用 Error 时才按默认语言生成信息，可以用作 errors.Is 比较的哨兵错误
+type msgError msgID
+
+func (e msgError) Error() string {
+	return msg(msgID(e))
+}
+
+func (e msgError) inLang(l Lang) string {
+	return format(l, msgID(e), nil)
+}
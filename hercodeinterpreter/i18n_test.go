@@ -0,0 +1,93 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const langScript = `start:
+    say 1 + true
+    say len(1)
+    exit(3)
+end
+`
+
+// 运行 langScript，返回错误输出和 Execute 返回的错误
+func runInLang(t *testing.T, l Lang) (string, []error) {
+	t.Helper()
+	var errOut bytes.Buffer
+	h := NewHerCodeInterpreter(WithLang(l), WithStdout(&bytes.Buffer{}), WithStderr(&errOut))
+	if err := h.Parse(langScript); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	_, errs := h.Execute(context.Background())
+	var found []error
+	for _, err := range errs {
+		if err != nil {
+			found = append(found, err)
+		}
+	}
+	return errOut.String(), found
+}
+
+// 两个解释器同时使用不同的语言，互不影响，也不改变默认语言
+func TestWithLangPerInterpreter(t *testing.T) {
+	want := map[Lang][]string{
+		LangZH: {"错误: 行 0, 类型不匹配: 数字 + 布尔值", "len() 第1个参数 x 必须是字符串、列表或字典，实际是数字", "脚本调用 exit(3) 结束运行"},
+		LangEN: {"error: line 0, type mismatch: number + boolean", "len() argument 1 (x) must be a string, list or dictionary, got a number", "the script called exit(3)"},
+	}
+	before := CurrentLang()
+
+	var wg sync.WaitGroup
+	for l, texts := range want {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				out, errs := runInLang(t, l)
+				if len(errs) != 1 {
+					t.Errorf("%s: errors = %v, want one ExitError", l, errs)
+					return
+				}
+				var exit *ExitError
+				if !errors.As(errs[0], &exit) || exit.Code != 3 {
+					t.Errorf("%s: error = %v, want *ExitError with code 3", l, errs[0])
+				}
+				all := out + errs[0].Error()
+				for _, text := range texts {
+					if !strings.Contains(all, text) {
+						t.Errorf("%s: output %q does not contain %q", l, all, text)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if CurrentLang() != before {
+		t.Errorf("default language changed to %s", CurrentLang())
+	}
+}
+
+// 名字检查的错误和其中的拼写建议也使用解释器的语言
+func TestWithLangResolveErrors(t *testing.T) {
+	src := "start:\n    name = 1\n    say nmae\nend\n"
+	tests := map[Lang]string{
+		LangZH: "行 3: 变量未定义: nmae，你是不是想写 name？（在函数 start 中）",
+		LangEN: "line 3: undefined variable: nmae. Did you mean name? (in function start)",
+	}
+	for l, want := range tests {
+		err := NewHerCodeInterpreter(WithLang(l)).Parse(src)
+		var errs ResolveErrors
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Fatalf("%s: Parse = %v, want one ResolveError", l, err)
+		}
+		if got := errs[0].Error(); got != want {
+			t.Errorf("%s: got %q, want %q", l, got, want)
+		}
+	}
+}
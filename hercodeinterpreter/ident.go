@@ -0,0 +1,60 @@
+package hercodeinterpreter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ==================== 标识符 ====================
+// 变量名、参数名和函数名按照 Unicode 的标识符规则（XID_Start / XID_Continue）：
+// 以字母（包括中文等各种文字）或下划线开头，后面是字母、数字、组合符号或连接符（如下划线），
+// 所以 分数、打招呼、café、x1 都是合法的名字，1x、a-b 不是。
+
+// 标识符的正则表达式，与 isIdent 相同。
+// 正则表达式不支持 Other_ID_Start / Other_ID_Continue 这样的属性，所以由同样的 Unicode 表生成
+var identPattern = func() string {
+	start := `\p{L}\p{Nl}_` + charClass(unicode.Other_ID_Start)
+	return `[` + start + `][` + start + `\p{Mn}\p{Mc}\p{Nd}\p{Pc}` + charClass(unicode.Other_ID_Continue) + `]*`
+}()
+
+// 把 Unicode 表写成正则表达式字符类的内容
+func charClass(table *unicode.RangeTable) string {
+	var b strings.Builder
+	add := func(lo, hi, stride uint32) {
+		if stride == 1 {
+			fmt.Fprintf(&b, `\x{%x}-\x{%x}`, lo, hi)
+			return
+		}
+		for r := lo; r <= hi; r += stride {
+			fmt.Fprintf(&b, `\x{%x}`, r)
+		}
+	}
+	for _, r := range table.R16 {
+		add(uint32(r.Lo), uint32(r.Hi), uint32(r.Stride))
+	}
+	for _, r := range table.R32 {
+		add(r.Lo, r.Hi, r.Stride)
+	}
+	return b.String()
+}
+
+// 可以作为标识符第一个字符
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.Is(unicode.Nl, r) || unicode.Is(unicode.Other_ID_Start, r)
+}
+
+// 可以出现在标识符第一个字符之后
+func isIdentContinue(r rune) bool {
+	return isIdentStart(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+}
+
+// 是否为合法的标识符
+func isIdent(s string) bool {
+	for i, r := range s {
+		if i == 0 && !isIdentStart(r) || i > 0 && !isIdentContinue(r) {
+			return false
+		}
+	}
+	return s != ""
+}
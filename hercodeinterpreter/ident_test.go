@@ -0,0 +1,49 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"unicode/utf8"
+)
+
+// identPattern 与 isIdentStart / isIdentContinue 接受同样的字符
+func TestIdentPatternMatchesIsIdent(t *testing.T) {
+	re := regexp.MustCompile(`^` + identPattern + `$`)
+	for r := rune(0); r <= utf8.MaxRune; r++ {
+		if !utf8.ValidRune(r) {
+			continue
+		}
+		if got := re.MatchString(string(r)); got != isIdentStart(r) {
+			t.Errorf("%U as the first character: pattern %v, isIdentStart %v", r, got, !got)
+		}
+		if got := re.MatchString("a" + string(r)); got != isIdentContinue(r) {
+			t.Errorf("%U after a: pattern %v, isIdentContinue %v", r, got, !got)
+		}
+	}
+}
+
+// 含有 Other_ID_Start（℘）和 Other_ID_Continue（·）字符的名字在声明和使用时都可以识别
+func TestOtherIDCharacters(t *testing.T) {
+	const src = `function ℘ a·b:
+    return a·b * 2
+end
+
+start:
+    var a·b = 1
+    say a·b
+    say ℘(a·b + 1)
+end
+`
+	for _, vm := range []bool{false, true} {
+		var out bytes.Buffer
+		h := NewHerCodeInterpreter(WithStdout(&out), WithVM(vm))
+		if err := h.Parse(src); err != nil {
+			t.Fatalf("vm=%v: Parse: %v", vm, err)
+		}
+		mustExecute(t, h)
+		if out.String() != "1\n4\n" {
+			t.Errorf("vm=%v: output = %q, want %q", vm, out.String(), "1\n4\n")
+		}
+	}
+}
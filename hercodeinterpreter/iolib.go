@@ -0,0 +1,20 @@
+package hercodeinterpreter
+
+// ==================== 输入输出标准库 ====================
+
+func init() {
+	registerBuiltin(&Builtin{Name: "input", Params: []Param{param("prompt")}, Fn: builtinInput})
+}
+
+// input([prompt]) 显示提示并从解释器的输入读取一行
+func builtinInput(ctx *Context, args []Value) (Value, error) {
+	prompt := ""
+	if len(args) == 1 {
+		prompt = args[0].String()
+	}
+	line, err := ctx.ReadLine(prompt)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: StringType, Str: line}, nil
+}
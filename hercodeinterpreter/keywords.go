@@ -0,0 +1,126 @@
+package hercodeinterpreter
+
+import "strings"
+
+// ==================== 关键字语言包 ====================
+// 语言包给关键字起别名，例如用“如果”代替 if、用“当”代替 while。
+// Parse 在解析每一行之前，先把字符串以外的别名替换成原来的关键字，之后的解析过程不变。
+// 别名必须是一个完整的单词：变量“当前”中的“当”不会被替换。全角冒号“：”当作“:”。
+
+// 关键字语言包
+type LanguagePack struct {
+	Name     string              `json:"name"`
+	Keywords map[string][]string `json:"keywords"` // 关键字 → 别名
+	Builtins map[string][]string `json:"builtins"` // 内置函数名 → 别名
+}
+
+// 中文关键字，默认开启
+var ChineseKeywords = &LanguagePack{
+	Name: "zh",
+	Keywords: map[string][]string{
+		"function": {"函数"},
+		"start":    {"开始"},
+		"end":      {"结束"},
+		"if":       {"如果"},
+		"else":     {"否则"},
+		"endif":    {"结束如果"},
+		"while":    {"当"},
+		"endwhile": {"结束当", "行了细狗"},
+		"say":      {"说"},
+		"var":      {"变量"},
+		"return":   {"返回"},
+		"true":     {"真"},
+		"false":    {"假"},
+	},
+}
+
+// 设置使用的关键字语言包，默认只有 ChineseKeywords，不传参数时只能使用英文关键字
+func WithLanguagePacks(packs ...*LanguagePack) Option {
+	return func(h *HerCodeInterpreter) { h.LanguagePacks = packs }
+}
+
+// 按解释器的内置函数表检查语言包，返回所有语言包中的别名 → 关键字或内置函数名，
+// 同一个别名在不同的语言包中对应不同的名字时返回错误
+func (h *HerCodeInterpreter) keywordAliases() (map[string]string, error) {
+	for _, pack := range h.LanguagePacks {
+		if err := pack.validate(h.Builtins); err != nil {
+			return nil, err
+		}
+	}
+	aliases := map[string]string{}
+	add := func(alias, name string) error {
+		if old, ok := aliases[alias]; ok && old != name {
+			return errorf(msgAliasConflict, alias, old, name)
+		}
+		aliases[alias] = name
+		return nil
+	}
+	for _, pack := range h.LanguagePacks {
+		for _, table := range []map[string][]string{pack.Keywords, pack.Builtins} {
+			for name, names := range table {
+				for _, alias := range names {
+					if err := add(alias, name); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return aliases, nil
+}
+
+// 把一行中字符串以外的别名替换成关键字或内置函数名
+func translateKeywords(line string, aliases map[string]string) string {
+	if len(aliases) == 0 {
+		return line
+	}
+
+	var b strings.Builder
+	runes := []rune(line)
+	inString := false
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if inString {
+			b.WriteRune(r)
+			if r == '\\' && i+1 < len(runes) {
+				b.WriteRune(runes[i+1])
+				i += 2
+				continue
+			}
+			if r == '"' {
+				inString = false
+			}
+			i++
+			continue
+		}
+		if r == '"' {
+			inString = true
+			b.WriteRune(r)
+			i++
+			continue
+		}
+		if r == '：' {
+			b.WriteRune(':')
+			i++
+			continue
+		}
+		if !isIdentContinue(r) {
+			b.WriteRune(r)
+			i++
+			continue
+		}
+
+		// 一个完整的单词
+		j := i
+		for j < len(runes) && isIdentContinue(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if keyword, ok := aliases[word]; ok {
+			word = keyword
+		}
+		b.WriteString(word)
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package hercodeinterpreter
+
+import (
+	"errors"
+	"io"
+)
+
+// 资源限制，用于在共享的服务中安全地运行不受信任的脚本，各项为 0 表示不限制
+type Limits struct {
+	MaxSteps          int64 // 最多执行的语句和表达式个数
+	MaxCallDepth      int   // 函数调用的最大嵌套深度
+	MaxStringBytes    int   // 单个字符串的最大字节数
+	MaxCollectionSize int   // 单个列表或字典的最大元素个数
+	MaxOutputBytes    int64 // 最多输出的字节数
+}
+
+// 默认限制：只限制调用深度，避免无限递归撑爆 Go 的栈
+var DefaultLimits = Limits{MaxCallDepth: 10000}
+
+// 设置资源限制，默认为 DefaultLimits
+func WithLimits(limits Limits) Option {
+	return func(h *HerCodeInterpreter) { h.Limits = limits }
+}
+
+// 超出各项资源限制时的错误，可以用 errors.Is 区分
+var (
+	ErrStepLimit       error = msgError(msgStepLimit)
+	ErrCallDepthLimit  error = msgError(msgCallDepthLimit)
+	ErrStringLimit     error = msgError(msgStringLimit)
+	ErrCollectionLimit error = msgError(msgCollectionLimit)
+	ErrOutputLimit     error = msgError(msgOutputLimit)
+)
+
+// 超出资源限制时返回的错误
+type LimitError struct {
+	Err   error // ErrStepLimit 等
+	Limit int64 // 设定的上限
+	Func  string
+	lang  Lang
+}
+
+func (e *LimitError) Error() string {
+	return e.inLang(e.lang)
+}
+
+func (e *LimitError) inLang(l Lang) string {
+	if e.Func != "" {
+		return format(l, msgLimitInCall, []any{e.Err, e.Limit, e.Func})
+	}
+	return format(l, msgLimit, []any{e.Err, e.Limit})
+}
+
+func (e *LimitError) setLang(l Lang) {
+	e.lang = l
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// 一次执行（Execute 或 Call）中的资源计数
+type runState struct {
+	steps         int64
+	depth         int
+	outputBytes   int64
+	printedErrors int // say 输出到错误输出的错误个数
+}
+
+// 计数一步，超过 MaxSteps 时返回错误
+func (c *Context) step() error {
+	if c.interp == nil {
+		return nil
+	}
+	h := c.interp
+	h.run.steps++
+	if h.Limits.MaxSteps > 0 && h.run.steps > h.Limits.MaxSteps {
+		return &LimitError{Err: ErrStepLimit, Limit: h.Limits.MaxSteps}
+	}
+	return nil
+}
+
+// 进入函数调用，超过 MaxCallDepth 时返回错误；返回的函数用于退出调用
+func (c *Context) enterCall(name string) (func(), error) {
+	if c.interp == nil {
+		return func() {}, nil
+	}
+	h := c.interp
+	if h.Limits.MaxCallDepth > 0 && h.run.depth >= h.Limits.MaxCallDepth {
+		return nil, &LimitError{Err: ErrCallDepthLimit, Limit: int64(h.Limits.MaxCallDepth), Func: name}
+	}
+	h.run.depth++
+	return func() { h.run.depth-- }, nil
+}
+
+// 检查即将生成的字符串是否超过 MaxStringBytes
+func (c *Context) checkStringBytes(n int) error {
+	if c.interp == nil || c.interp.Limits.MaxStringBytes <= 0 || n <= c.interp.Limits.MaxStringBytes {
+		return nil
+	}
+	return &LimitError{Err: ErrStringLimit, Limit: int64(c.interp.Limits.MaxStringBytes)}
+}
+
+// 检查即将生成的列表或字典是否超过 MaxCollectionSize
+func (c *Context) checkCollectionSize(n int) error {
+	if c.interp == nil || c.interp.Limits.MaxCollectionSize <= 0 || n <= c.interp.Limits.MaxCollectionSize {
+		return nil
+	}
+	return &LimitError{Err: ErrCollectionLimit, Limit: int64(c.interp.Limits.MaxCollectionSize)}
+}
+
+// 检查一个值的大小是否在限制之内
+func (c *Context) checkValue(v Value) error {
+	switch v.Type {
+	case StringType:
+		return c.checkStringBytes(len(v.Str))
+	case SliceType:
+		return c.checkCollectionSize(len(v.Slice))
+	case MapType:
+		return c.checkCollectionSize(len(v.Map))
+	}
+	return nil
+}
+
+// 统计输出字节数的 Writer，超过 MaxOutputBytes 时拒绝写入
+type limitedWriter struct {
+	w io.Writer
+	h *HerCodeInterpreter
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	h := lw.h
+	if max := h.Limits.MaxOutputBytes; max > 0 && h.run.outputBytes+int64(len(p)) > max {
+		return 0, &LimitError{Err: ErrOutputLimit, Limit: max}
+	}
+	n, err := lw.w.Write(p)
+	h.run.outputBytes += int64(n)
+	return n, err
+}
+
+// 是否为需要立即停止整个执行的错误（超时、取消、超出资源限制、死循环或调用了 exit）
+func isFatal(err error) bool {
+	var timeout *TimeoutError
+	var limit *LimitError
+	var loop *InfiniteLoopError
+	var exit *ExitError
+	return errors.As(err, &timeout) || errors.As(err, &limit) || errors.As(err, &loop) || errors.As(err, &exit)
+}
@@ -0,0 +1,458 @@
+package hercodeinterpreter
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ==================== 静态检查 ====================
+// hercode lint 不运行脚本，找出新手常犯的错误：没有用到的变量和参数、赋值之前就使用的变量、
+// return 后面执行不到的代码、用 endif 结束 while、结果永远不变的条件、与内置函数同名的函数、
+// 从来没有被调用的函数等。每个问题都有规则编号、严重程度和一句解释。
+//
+// 检查在 ParseTree 得到的具体语法树上进行，脚本有语法错误时其余的问题也照样报告。
+// 变量是动态作用域的（见 resolver.go），所以只要脚本中任何地方读取了一个变量，它就不算没有用到。
+
+// 问题的严重程度
+type Severity int
+
+const (
+	SeverityError   Severity = iota // 脚本无法运行，或者运行到这里一定会出错
+	SeverityWarning                 // 很可能是写错了
+	SeverityInfo                    // 提示，不影响运行
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "info"
+}
+
+// 检查规则的编号
+const (
+	RuleSyntax            = "syntax"             // 语法错误
+	RuleNames             = "name-check"         // 未定义的变量或函数、参数个数不对
+	RuleMismatchedEnd     = "mismatched-end"     // 用 endif 结束 while，或用 endwhile 结束 if
+	RuleUseBeforeAssign   = "use-before-assign"  // 变量在赋值之前就被使用
+	RuleUnusedVariable    = "unused-variable"    // 变量赋值之后没有被使用
+	RuleUnusedParameter   = "unused-parameter"   // 参数没有被使用
+	RuleUnreachable       = "unreachable-code"   // return 后面的代码
+	RuleConstantCondition = "constant-condition" // if 或 while 的条件总是 true 或总是 false
+	RuleShadowedBuiltin   = "shadowed-builtin"   // 与内置函数或内置常量同名
+	RuleUnusedFunction    = "unused-function"    // 定义了但没有被调用的函数
+	RuleOutsideFunction   = "outside-function"   // 不在任何函数中、不会执行的代码
+)
+
+// 每条规则的严重程度
+var ruleSeverity = map[string]Severity{
+	RuleSyntax:            SeverityError,
+	RuleNames:             SeverityError,
+	RuleMismatchedEnd:     SeverityWarning,
+	RuleUseBeforeAssign:   SeverityError,
+	RuleUnusedVariable:    SeverityWarning,
+	RuleUnusedParameter:   SeverityWarning,
+	RuleUnreachable:       SeverityWarning,
+	RuleConstantCondition: SeverityWarning,
+	RuleShadowedBuiltin:   SeverityWarning,
+	RuleOutsideFunction:   SeverityWarning,
+	RuleUnusedFunction:    SeverityInfo,
+}
+
+// 静态检查发现的一个问题
+type Diagnostic struct {
+	Line     int
+	Severity Severity
+	Rule     string
+	Msg      string
+	lang     Lang
+}
+
+func (d Diagnostic) String() string {
+	return format(d.lang, msgLintDiagnostic, []any{d.Line, d.Msg, d.Rule})
+}
+
+type linter struct {
+	h       *HerCodeInterpreter
+	aliases map[string]string
+	funcs   []*Node            // FuncNode 和 StartNode
+	reads   map[string]bool    // 脚本中读取过的变量
+	assigns map[string][]*Node // 给变量赋值的函数
+	calls   map[string][]*Node // 调用函数的函数
+	diags   []Diagnostic
+}
+
+// 检查脚本，按行号返回发现的问题。只有关键字语言包有冲突时才返回错误
+func (h *HerCodeInterpreter) Lint(src string) (_ []Diagnostic, err error) {
+	defer func() { err = h.localize(err) }()
+	tree, err := h.ParseTree(src)
+	if tree == nil {
+		return nil, err
+	}
+	aliases, err := h.keywordAliases()
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{
+		h:       h,
+		aliases: aliases,
+		reads:   map[string]bool{},
+		assigns: map[string][]*Node{},
+		calls:   map[string][]*Node{},
+	}
+
+	l.structure(tree)
+	if len(tree.Errors) == 0 {
+		l.names(src)
+	}
+	for _, fn := range l.funcs {
+		l.collect(fn)
+	}
+	for _, fn := range l.funcs {
+		l.function(fn)
+	}
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		if l.diags[i].Line != l.diags[j].Line {
+			return l.diags[i].Line < l.diags[j].Line
+		}
+		return l.diags[i].Rule < l.diags[j].Rule
+	})
+	return l.diags, nil
+}
+
+func (l *linter) report(line int, rule string, text string) {
+	l.diags = append(l.diags, Diagnostic{Line: line, Severity: ruleSeverity[rule], Rule: rule, Msg: text, lang: l.h.lang})
+}
+
+// 按解释器的语言生成说明
+func (l *linter) msg(id msgID, args ...any) string {
+	return format(l.h.lang, id, args)
+}
+
+// 语法错误的说明。诊断已经带有行号，去掉错误开头重复的“行 N: ”和“行 N, ”
+func (l *linter) syntaxMsg(err error, line int) string {
+	text := inLang(err, l.h.lang)
+	text = strings.TrimPrefix(text, l.msg(msgAtLine, line, ""))
+	return strings.TrimPrefix(text, l.msg(msgLinePrefix, line))
+}
+
+// 语法错误、不匹配的 endif / endwhile，以及函数外面的代码
+func (l *linter) structure(tree *SyntaxTree) {
+	for _, n := range tree.Nodes {
+		switch {
+		case isFuncNode(n):
+			l.funcs = append(l.funcs, n)
+		case n.Kind != BlankNode && n.Kind != CommentNode && n.Err == nil:
+			l.report(n.Line.Num, RuleOutsideFunction, l.msg(msgLintOutsideFunction))
+		}
+	}
+	tree.Inspect(func(n *Node) bool {
+		if n.End != nil && (n.Kind == IfNode || n.Kind == WhileNode) {
+			end := leadingKeyword(strings.TrimSpace(translateKeywords(n.End.Code, l.aliases)))
+			switch {
+			case n.Kind == WhileNode && end == "endif":
+				l.report(n.End.Num, RuleMismatchedEnd, l.msg(msgLintEndifClosesWhile, n.Line.Num))
+				return true
+			case n.Kind == IfNode && end == "endwhile":
+				l.report(n.End.Num, RuleMismatchedEnd, l.msg(msgLintEndwhileClosesIf, n.Line.Num))
+				return true
+			}
+		}
+		if n.Err != nil {
+			l.report(n.Line.Num, RuleSyntax, l.syntaxMsg(n.Err, n.Line.Num))
+		}
+		return true
+	}, nil)
+}
+
+// 用 Parse 检查未定义的名字和参数个数，宿主程序注册的函数和全局变量都算已定义
+func (l *linter) names(src string) {
+	check := NewHerCodeInterpreter(WithLanguagePacks(l.h.LanguagePacks...), WithLang(l.h.lang))
+	check.Builtins = l.h.Builtins
+	for name, v := range l.h.GlobalCtx.Variables {
+		check.GlobalCtx.SetVar(name, v)
+	}
+	var resolveErrs ResolveErrors
+	if errors.As(check.Parse(src), &resolveErrs) {
+		for _, e := range resolveErrs {
+			l.report(e.Line, RuleNames, e.Msg)
+		}
+	}
+}
+
+// 记录函数中读取和赋值的变量、调用的函数
+func (l *linter) collect(fn *Node) {
+	walkNodes(fn.Children, func(n *Node) {
+		if name := assignedName(n.Stmt); name != "" {
+			l.assigns[name] = append(l.assigns[name], fn)
+		}
+		stmtExprs(n.Stmt, func(e Expression) {
+			switch e := e.(type) {
+			case *VarRefExpr:
+				l.reads[e.Name] = true
+			case *FuncCallExpr:
+				l.calls[e.Name] = append(l.calls[e.Name], fn)
+			}
+		})
+		if call, ok := n.Stmt.(*FuncCallStmt); ok {
+			l.calls[call.Name] = append(l.calls[call.Name], fn)
+		}
+	})
+}
+
+// 检查一个函数
+func (l *linter) function(fn *Node) {
+	params := map[string]bool{}
+	for _, p := range fn.Params {
+		params[p] = true
+		if !l.reads[p] {
+			l.report(fn.Line.Num, RuleUnusedParameter, l.msg(msgLintUnusedParam, p, fn.Name))
+		}
+		if _, ok := builtinConstants[p]; ok {
+			l.report(fn.Line.Num, RuleShadowedBuiltin, l.msg(msgLintShadowConstant, p))
+		}
+	}
+	if fn.Kind == FuncNode && fn.Name != "" {
+		if _, ok := l.h.Builtins[fn.Name]; ok {
+			l.report(fn.Line.Num, RuleShadowedBuiltin, l.msg(msgLintShadowBuiltin, fn.Name))
+		}
+		l.unusedFunction(fn)
+	}
+
+	// 每个变量第一次赋值的行
+	firstAssign := map[string]int{}
+	walkNodes(fn.Children, func(n *Node) {
+		if name := assignedName(n.Stmt); name != "" && firstAssign[name] == 0 {
+			firstAssign[name] = n.Line.Num
+			if !l.reads[name] && !params[name] {
+				l.report(n.Line.Num, RuleUnusedVariable, l.msg(msgLintUnusedVar, name))
+			}
+			if _, ok := builtinConstants[name]; ok {
+				l.report(n.Line.Num, RuleShadowedBuiltin, l.msg(msgLintShadowConstant, name))
+			}
+		}
+	})
+
+	reported := map[string]bool{}
+	walkNodes(fn.Children, func(n *Node) {
+		stmtExprs(n.Stmt, func(e Expression) {
+			ref, ok := e.(*VarRefExpr)
+			if !ok || reported[ref.Name] || !l.usedBeforeAssign(fn, ref, params, firstAssign) {
+				return
+			}
+			reported[ref.Name] = true
+			l.report(ref.Line, RuleUseBeforeAssign, l.msg(msgLintUseBeforeAssign, ref.Name, firstAssign[ref.Name]))
+		})
+		if n.Kind == IfNode || n.Kind == WhileNode {
+			l.condition(n)
+		}
+	})
+
+	l.unreachable(fn.Children)
+}
+
+// 变量在本函数中赋值之前就被读取，而且不是参数，也不可能来自其他函数或宿主程序
+func (l *linter) usedBeforeAssign(fn *Node, ref *VarRefExpr, params map[string]bool, firstAssign map[string]int) bool {
+	line, ok := firstAssign[ref.Name]
+	if !ok || line < ref.Line || params[ref.Name] {
+		return false
+	}
+	for _, other := range l.assigns[ref.Name] {
+		if other != fn {
+			return false
+		}
+	}
+	if _, ok := l.h.GlobalCtx.Variables[ref.Name]; ok {
+		return false
+	}
+	_, ok = builtinConstants[ref.Name]
+	return !ok
+}
+
+// 函数没有被其他函数调用。没有 start 的脚本可能是给宿主程序调用的函数库，不检查；
+// 测试函数由 hercode test 调用，也不检查
+func (l *linter) unusedFunction(fn *Node) {
+	hasStart := false
+	for _, f := range l.funcs {
+		hasStart = hasStart || f.Kind == StartNode
+	}
+	if !hasStart || strings.HasPrefix(fn.Name, "test") && len(fn.Params) == 0 {
+		return
+	}
+	for _, caller := range l.calls[fn.Name] {
+		if caller != fn {
+			return
+		}
+	}
+	l.report(fn.Line.Num, RuleUnusedFunction, l.msg(msgLintUnusedFunc, fn.Name))
+}
+
+// 条件的结果永远不变的 if 和 while
+func (l *linter) condition(n *Node) {
+	var cond Expression
+	switch s := n.Stmt.(type) {
+	case *IfStmt:
+		cond = s.Condition
+	case *WhileStmt:
+		cond = s.Condition
+	}
+	value, ok := constantCondition(cond)
+	if !ok {
+		return
+	}
+	switch {
+	case n.Kind == IfNode && value:
+		l.report(n.Line.Num, RuleConstantCondition, l.msg(msgLintIfAlwaysTrue))
+	case n.Kind == IfNode:
+		l.report(n.Line.Num, RuleConstantCondition, l.msg(msgLintIfAlwaysFalse))
+	case !value:
+		l.report(n.Line.Num, RuleConstantCondition, l.msg(msgLintWhileNever))
+	case !canLeave(n.Children):
+		// while true 配合 return 或 exit 是常见的写法，两者都没有时循环才永远不会结束
+		l.report(n.Line.Num, RuleConstantCondition, l.msg(msgLintWhileForever))
+	}
+}
+
+// 块中 return 后面的语句，每个块只报告第一条
+func (l *linter) unreachable(nodes []*Node) {
+	returned := false
+	for _, n := range nodes {
+		if n.Kind == BlankNode || n.Kind == CommentNode {
+			continue
+		}
+		if returned {
+			l.report(n.Line.Num, RuleUnreachable, l.msg(msgLintUnreachable))
+			break
+		}
+		if _, ok := n.Stmt.(*ReturnStmt); ok && n.Kind == StmtNode {
+			returned = true
+		}
+	}
+	for _, n := range nodes {
+		if n.IsBlock() {
+			l.unreachable(n.Children)
+			l.unreachable(n.ElseChildren)
+		}
+	}
+}
+
+// 条件不读取变量也不调用函数时，结果可以直接算出来；x == x 这样两边是同一个变量的比较结果也不变
+func constantCondition(cond Expression) (value, ok bool) {
+	if bin, isBin := cond.(*BinOpExpr); isBin {
+		left, isLeftRef := bin.Left.(*VarRefExpr)
+		right, isRightRef := bin.Right.(*VarRefExpr)
+		if isLeftRef && isRightRef && left.Name == right.Name {
+			switch bin.Operator {
+			case "==", "<=", ">=":
+				return true, true
+			case "!=", "<", ">":
+				return false, true
+			}
+		}
+	}
+
+	pure := true
+	visitExpr(cond, func(e Expression) {
+		switch e.(type) {
+		case *VarRefExpr, *FuncCallExpr:
+			pure = false
+		}
+	})
+	if !pure {
+		return false, false
+	}
+	v, err := cond.Eval(NewContext(nil))
+	if err != nil || v.Type != BoolType {
+		return false, false
+	}
+	return v.Bool, true
+}
+
+// 块中（包括嵌套的块）是否有 return 或函数调用，函数调用可能用 exit 结束整个程序
+func canLeave(nodes []*Node) bool {
+	found := false
+	walkNodes(nodes, func(n *Node) {
+		switch n.Stmt.(type) {
+		case *ReturnStmt, *FuncCallStmt:
+			found = true
+		}
+		stmtExprs(n.Stmt, func(e Expression) {
+			if _, ok := e.(*FuncCallExpr); ok {
+				found = true
+			}
+		})
+	})
+	return found
+}
+
+// 按源代码的顺序遍历块中的语句节点，包括嵌套的块
+func walkNodes(nodes []*Node, visit func(n *Node)) {
+	for _, n := range nodes {
+		if n.Stmt != nil {
+			visit(n)
+		}
+		walkNodes(n.Children, visit)
+		walkNodes(n.ElseChildren, visit)
+	}
+}
+
+// 语句赋值的变量，不赋值时为空
+func assignedName(stmt Statement) string {
+	switch s := stmt.(type) {
+	case *VarDeclStmt:
+		return s.VarName
+	case *AssignStmt:
+		return s.VarName
+	case *AskStmt:
+		return s.VarName
+	}
+	return ""
+}
+
+// 访问语句中的每一个表达式节点。if 和 while 节点中只有条件
+func stmtExprs(stmt Statement, visit func(e Expression)) {
+	switch s := stmt.(type) {
+	case *SayStmt:
+		visitExpr(s.Expr, visit)
+	case *VarDeclStmt:
+		visitExpr(s.Expr, visit)
+	case *AssignStmt:
+		visitExpr(s.Expr, visit)
+	case *AskStmt:
+		visitExpr(s.Prompt, visit)
+	case *ReturnStmt:
+		visitExpr(s.Expr, visit)
+	case *IfStmt:
+		visitExpr(s.Condition, visit)
+	case *WhileStmt:
+		visitExpr(s.Condition, visit)
+	case *FuncCallStmt:
+		for _, arg := range s.Arguments {
+			visitExpr(arg, visit)
+		}
+	}
+}
+
+// 先访问表达式本身，再访问子表达式。赋值表达式左边的变量不算读取
+func visitExpr(expr Expression, visit func(e Expression)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+	switch e := expr.(type) {
+	case *BinOpExpr:
+		if _, isVar := e.Left.(*VarRefExpr); !isVar || e.Operator != "=" {
+			visitExpr(e.Left, visit)
+		}
+		visitExpr(e.Right, visit)
+	case *FuncCallExpr:
+		for _, arg := range e.Arguments {
+			visitExpr(arg, visit)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package hercodeinterpreter
+
+import "testing"
+
+// while true 中有 return 或函数调用（例如 exit）时可以结束，只有两者都没有时才报告
+func TestLintWhileTrue(t *testing.T) {
+	for body, want := range map[string]bool{
+		"x = x + 1": true,
+		"return x":  false,
+		"exit(0)":   false,
+		"if x > 3\n            exit(0)\n        endif": false,
+		"x = x + len(\"ab\")":                          false,
+	} {
+		src := "start:\n    var x = 1\n    while true\n        " + body + "\n    endwhile\n    say x\nend\n"
+		found, err := NewHerCodeInterpreter().Lint(src)
+		if err != nil {
+			t.Fatalf("Lint: %v", err)
+		}
+		got := false
+		for _, d := range found {
+			if d.Rule == RuleConstantCondition && d.Line == 3 {
+				got = true
+			}
+		}
+		if got != want {
+			t.Errorf("while true with %q: reported = %v, want %v (diagnostics %v)", body, got, want, found)
+		}
+	}
+}
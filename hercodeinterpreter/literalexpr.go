@@ -12,5 +12,9 @@ func (e *LiteralExpr) String() string {
 }
 
 func (e *LiteralExpr) Eval(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	return e.Value, nil
 }
@@ -0,0 +1,179 @@
+package hercodeinterpreter
+
+import "strings"
+
+// ==================== 死循环检测 ====================
+// 新手模式下，如果 while 的条件只依赖变量（不调用函数），而这些变量在一轮循环之后都没有变化，
+// 条件的结果就永远不会变，循环也就永远不会结束。
+// 循环体中调用了函数时不检测：exit 可以结束整个程序，用户函数也可能修改条件中的变量。
+// 静态检查：循环体里根本没有给条件中的变量赋值，也没有 return，进入循环时就能确定是死循环。
+// 动态检查：循环体执行了一轮，条件中的变量的值都和上一轮一样（例如 i = i + 0）。
+
+// 检测到死循环时返回的错误
+type InfiniteLoopError struct {
+	Line  int
+	Vars  []string // 条件中从未改变的变量
+	first Value    // Vars[0] 的值，用于给出修改它的例子
+	lang  Lang
+}
+
+func (e *InfiniteLoopError) Error() string {
+	return e.inLang(e.lang)
+}
+
+func (e *InfiniteLoopError) inLang(l Lang) string {
+	return format(l, msgInfiniteLoop, []any{e.Line, strings.Join(e.Vars, format(l, msgListSep, nil)), e.example(l)})
+}
+
+// 按变量的类型给出修改它的例子：数字加 1，布尔值取反，其他的值重新读入
+func (e *InfiniteLoopError) example(l Lang) string {
+	name := e.Vars[0]
+	switch e.first.Type {
+	case BoolType:
+		return format(l, msgLoopFlipBool, []any{name, !e.first.Bool})
+	case StringType, SliceType, MapType:
+		return format(l, msgLoopAskAgain, []any{name})
+	}
+	return format(l, msgLoopIncrement, []any{name})
+}
+
+func (e *InfiniteLoopError) setLang(l Lang) {
+	e.lang = l
+}
+
+// 收集表达式中引用的变量；表达式中有函数调用时结果可能每次不同，pure 为 false
+func conditionVars(expr Expression) (vars []string, pure bool) {
+	seen := map[string]bool{}
+	pure = true
+	var walk func(e Expression)
+	walk = func(e Expression) {
+		switch e := e.(type) {
+		case *VarRefExpr:
+			if !seen[e.Name] {
+				seen[e.Name] = true
+				vars = append(vars, e.Name)
+			}
+		case *BinOpExpr:
+			walk(e.Left)
+			walk(e.Right)
+		case *FuncCallExpr:
+			pure = false
+		}
+	}
+	walk(expr)
+	return vars, pure
+}
+
+// 收集语句块中被赋值的变量，以及是否包含 return
+func assignedVars(stmts []Statement, assigned map[string]bool) (hasReturn bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *AssignStmt:
+			assigned[s.VarName] = true
+		case *VarDeclStmt:
+			assigned[s.VarName] = true
+		case *AskStmt:
+			assigned[s.VarName] = true
+		case *ReturnStmt:
+			hasReturn = true
+		case *IfStmt:
+			if assignedVars(s.ThenBranch, assigned) {
+				hasReturn = true
+			}
+			if assignedVars(s.ElseBranch, assigned) {
+				hasReturn = true
+			}
+		case *WhileStmt:
+			if assignedVars(s.Body, assigned) {
+				hasReturn = true
+			}
+		}
+	}
+	return hasReturn
+}
+
+// 分析 while 循环的条件和循环体，结果缓存在 WhileStmt 中
+func (s *WhileStmt) analyze() {
+	if s.analyzed {
+		return
+	}
+	s.analyzed = true
+	s.condVars, s.condPure = conditionVars(s.Condition)
+	if !s.condPure || len(s.condVars) == 0 {
+		return
+	}
+
+	calls := false
+	walkCalls(s.Body, func(string) { calls = true })
+	if calls {
+		s.condPure = false
+		return
+	}
+
+	assigned := map[string]bool{}
+	if assignedVars(s.Body, assigned) {
+		return
+	}
+	for _, v := range s.condVars {
+		if assigned[v] {
+			return
+		}
+	}
+	s.neverChanges = true
+}
+
+// 记录条件中变量的当前值
+func (s *WhileStmt) snapshot(ctx *Context) []Value {
+	vals := make([]Value, len(s.condVars))
+	for i, name := range s.condVars {
+		vals[i], _ = ctx.GetVar(name)
+	}
+	return vals
+}
+
+func snapshotsEqual(a, b []Value) bool {
+	for i := range a {
+		if !valuesEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 比较两个值是否相同
+func valuesEqual(a, b Value) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case NumberType:
+		return a.Num == b.Num
+	case StringType:
+		return a.Str == b.Str
+	case BoolType:
+		return a.Bool == b.Bool
+	case SliceType:
+		if len(a.Slice) != len(b.Slice) {
+			return false
+		}
+		for i := range a.Slice {
+			if !valuesEqual(a.Slice[i], b.Slice[i]) {
+				return false
+			}
+		}
+		return true
+	case MapType:
+		if len(a.Map) != len(b.Map) {
+			return false
+		}
+		for k, v := range a.Map {
+			if w, ok := b.Map[k]; !ok || !valuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case FunctionType:
+		return a.Func == b.Func && a.Host == b.Host
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 新手模式下运行脚本，返回输出和 Execute 返回的第一个 Go 错误
+func runBeginner(t *testing.T, src, input string, vm bool) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	h := NewHerCodeInterpreter(WithStdout(&out), WithStdin(strings.NewReader(input)),
+		WithBeginnerMode(true), WithVM(vm), WithLang(LangEN))
+	if err := h.Parse(src); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	_, errs := h.Execute(context.Background())
+	for _, err := range errs {
+		if err != nil {
+			return out.String(), err
+		}
+	}
+	return out.String(), nil
+}
+
+// 循环体中的 exit 或用户函数可以结束循环，这样的循环不被当作死循环
+func TestLoopWithCallsIsNotInfinite(t *testing.T) {
+	for name, src := range map[string]string{
+		"exit": `start:
+    var playing = true
+    while playing
+        ask "again? " into answer
+        if answer == "n"
+            exit(0)
+        endif
+    endwhile
+end
+`,
+		"user function": `function stop:
+    exit(0)
+end
+
+start:
+    var playing = true
+    while playing
+        ask "again? " into answer
+        if answer == "n"
+            stop()
+        endif
+    endwhile
+end
+`,
+	} {
+		for _, vm := range []bool{false, true} {
+			out, err := runBeginner(t, src, "y\ny\nn\n", vm)
+			var loop *InfiniteLoopError
+			if errors.As(err, &loop) {
+				t.Errorf("%s, vm=%v: %v", name, vm, err)
+			}
+			if out != "again? again? again? " {
+				t.Errorf("%s, vm=%v: output = %q, want three prompts", name, vm, out)
+			}
+		}
+	}
+}
+
+// 死循环的提示按条件中变量的类型给出修改它的例子
+func TestInfiniteLoopExample(t *testing.T) {
+	for _, tc := range []struct {
+		init, cond, example string
+	}{
+		{`var i = 0`, `i < 3`, "for example i = i + 1"},
+		{`var playing = true`, `playing`, "for example playing = false"},
+		{`var done = false`, `done == false`, "for example done = true"},
+		{`var answer = "y"`, `answer != "n"`, `for example ask "Keep going?" into answer`},
+	} {
+		src := "start:\n    " + tc.init + "\n    var n = 0\n    while " + tc.cond + "\n        n = n + 1\n    endwhile\nend\n"
+		for _, vm := range []bool{false, true} {
+			_, err := runBeginner(t, src, "", vm)
+			var loop *InfiniteLoopError
+			if !errors.As(err, &loop) {
+				t.Errorf("while %s, vm=%v: err = %v, want InfiniteLoopError", tc.cond, vm, err)
+				continue
+			}
+			if !strings.HasSuffix(err.Error(), tc.example) {
+				t.Errorf("while %s, vm=%v: %q, want it to end with %q", tc.cond, vm, err, tc.example)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package hercodeinterpreter
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ==================== 数学标准库 ====================
+
+// 内置常量，可以像变量一样直接使用，也可以被同名变量覆盖
+var builtinConstants = map[string]Value{
+	"pi": {Type: NumberType, Num: math.Pi},
+	"e":  {Type: NumberType, Num: math.E},
+}
+
+// 随机数生成器，用 SeedRandom 设定种子后结果可以复现
+var (
+	randMu sync.Mutex
+	rng    = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// 设置随机数种子，让 random、random_int、choice、shuffle 的结果可以复现
+func SeedRandom(seed int64) {
+	randMu.Lock()
+	defer randMu.Unlock()
+	rng = rand.New(rand.NewSource(seed))
+}
+
+func init() {
+	num := param("num", NumberType)
+	registerBuiltin(&Builtin{Name: "sqrt", Params: []Param{num}, MinArgs: 1, Fn: builtinSqrt})
+	registerBuiltin(&Builtin{Name: "abs", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Abs)})
+	registerBuiltin(&Builtin{Name: "floor", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Floor)})
+	registerBuiltin(&Builtin{Name: "ceil", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Ceil)})
+	registerBuiltin(&Builtin{Name: "sin", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Sin)})
+	registerBuiltin(&Builtin{Name: "cos", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Cos)})
+	registerBuiltin(&Builtin{Name: "tan", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Tan)})
+	registerBuiltin(&Builtin{Name: "exp", Params: []Param{num}, MinArgs: 1, Fn: mathFunc1(math.Exp)})
+	registerBuiltin(&Builtin{Name: "round", Params: []Param{num, param("digits", NumberType)}, MinArgs: 1, Fn: builtinRound})
+	registerBuiltin(&Builtin{Name: "pow", Params: []Param{param("base", NumberType), param("exp", NumberType)}, MinArgs: 2, Fn: builtinPow})
+	registerBuiltin(&Builtin{Name: "log", Params: []Param{num, param("base", NumberType)}, MinArgs: 1, Fn: builtinLog})
+	registerBuiltin(&Builtin{Name: "min", Params: []Param{param("nums", NumberType, SliceType)}, MinArgs: 1, Variadic: true, Fn: builtinMin})
+	registerBuiltin(&Builtin{Name: "max", Params: []Param{param("nums", NumberType, SliceType)}, MinArgs: 1, Variadic: true, Fn: builtinMax})
+	registerBuiltin(&Builtin{Name: "random", Fn: builtinRandom})
+	registerBuiltin(&Builtin{Name: "random_int", Params: []Param{param("a", NumberType), param("b", NumberType)}, MinArgs: 2, Fn: builtinRandomInt})
+	registerBuiltin(&Builtin{Name: "choice", Params: []Param{param("list", SliceType, StringType)}, MinArgs: 1, Fn: builtinChoice})
+	registerBuiltin(&Builtin{Name: "shuffle", Params: []Param{param("list", SliceType)}, MinArgs: 1, Fn: builtinShuffle})
+}
+
+// 把单参数的 math 函数包装成内置函数
+func mathFunc1(f func(float64) float64) BuiltinFunc {
+	return func(ctx *Context, args []Value) (Value, error) {
+		return Value{Type: NumberType, Num: f(args[0].Num)}, nil
+	}
+}
+
+func builtinSqrt(ctx *Context, args []Value) (Value, error) {
+	n := args[0].Num
+	if n < 0 {
+		return Value{}, errorf(msgSqrtNegative)
+	}
+	return Value{Type: NumberType, Num: math.Sqrt(n)}, nil
+}
+
+// round(num[, digits]) 四舍五入，digits 为保留的小数位数
+func builtinRound(ctx *Context, args []Value) (Value, error) {
+	n := args[0].Num
+	if len(args) == 1 {
+		return Value{Type: NumberType, Num: math.Round(n)}, nil
+	}
+	digits, err := argInt("round", args, 1)
+	if err != nil {
+		return Value{}, err
+	}
+	scale := math.Pow(10, float64(digits))
+	return Value{Type: NumberType, Num: math.Round(n*scale) / scale}, nil
+}
+
+func builtinPow(ctx *Context, args []Value) (Value, error) {
+	return Value{Type: NumberType, Num: math.Pow(args[0].Num, args[1].Num)}, nil
+}
+
+// log(num[, base]) 默认为自然对数
+func builtinLog(ctx *Context, args []Value) (Value, error) {
+	n := args[0].Num
+	if n <= 0 {
+		return Value{}, errorf(msgLogNonPositive)
+	}
+	if len(args) == 1 {
+		return Value{Type: NumberType, Num: math.Log(n)}, nil
+	}
+	base := args[1].Num
+	if base <= 0 || base == 1 {
+		return Value{}, errorf(msgLogBase)
+	}
+	return Value{Type: NumberType, Num: math.Log(n) / math.Log(base)}, nil
+}
+
+func builtinMin(ctx *Context, args []Value) (Value, error) {
+	return extremum("min", args, func(a, b float64) bool { return a < b })
+}
+
+func builtinMax(ctx *Context, args []Value) (Value, error) {
+	return extremum("max", args, func(a, b float64) bool { return a > b })
+}
+
+// min/max 既可以传多个数字，也可以只传一个数字列表
+func extremum(name string, args []Value, better func(a, b float64) bool) (Value, error) {
+	nums := args
+	if len(args) == 1 && args[0].Type == SliceType {
+		nums = args[0].Slice
+		if len(nums) == 0 {
+			return Value{}, errorf(msgEmptyList, name)
+		}
+	}
+
+	var result float64
+	for i, n := range nums {
+		if n.Type != NumberType {
+			return Value{}, errorf(msgCompareNonNumber, name, i+1, n.Type)
+		}
+		if i == 0 || better(n.Num, result) {
+			result = n.Num
+		}
+	}
+	return Value{Type: NumberType, Num: result}, nil
+}
+
+// random() 返回 [0, 1) 之间的随机小数
+func builtinRandom(ctx *Context, args []Value) (Value, error) {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return Value{Type: NumberType, Num: rng.Float64()}, nil
+}
+
+// random_int(a, b) 返回 [a, b] 之间的随机整数
+func builtinRandomInt(ctx *Context, args []Value) (Value, error) {
+	lo, err := argInt("random_int", args, 0)
+	if err != nil {
+		return Value{}, err
+	}
+	hi, err := argInt("random_int", args, 1)
+	if err != nil {
+		return Value{}, err
+	}
+	if lo > hi {
+		return Value{}, errorf(msgRandomRange)
+	}
+	// 上下限相差太大时 hi-lo+1 会溢出
+	span := hi - lo + 1
+	if span <= 0 {
+		return Value{}, errorf(msgRandomTooWide)
+	}
+
+	randMu.Lock()
+	defer randMu.Unlock()
+	return Value{Type: NumberType, Num: float64(lo + rng.Intn(span))}, nil
+}
+
+// choice(list) 随机取出列表中的一个元素，也可以从字符串中随机取一个字符
+func builtinChoice(ctx *Context, args []Value) (Value, error) {
+	randMu.Lock()
+	defer randMu.Unlock()
+
+	if args[0].Type == SliceType {
+		if len(args[0].Slice) == 0 {
+			return Value{}, errorf(msgEmptyList, "choice")
+		}
+		return args[0].Slice[rng.Intn(len(args[0].Slice))], nil
+	}
+
+	runes := []rune(args[0].Str)
+	if len(runes) == 0 {
+		return Value{}, errorf(msgEmptyString, "choice")
+	}
+	return Value{Type: StringType, Str: string(runes[rng.Intn(len(runes))])}, nil
+}
+
+// shuffle(list) 返回打乱顺序后的新列表，原列表不变
+func builtinShuffle(ctx *Context, args []Value) (Value, error) {
+	shuffled := make([]Value, len(args[0].Slice))
+	copy(shuffled, args[0].Slice)
+
+	randMu.Lock()
+	defer randMu.Unlock()
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return Value{Type: SliceType, Slice: shuffled}, nil
+}
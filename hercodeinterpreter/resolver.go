@@ -0,0 +1,277 @@
+package hercodeinterpreter
+
+import (
+	"sort"
+	"strings"
+)
+
+// ==================== 名字解析 ====================
+// Parse 之后检查每个变量和函数调用，在运行之前就报告未定义的变量、未定义的函数和参数个数不对的调用，
+// 不用等到执行到那一行（比如很少走到的 else 分支）才发现拼写错误。
+//
+// 变量是动态作用域的：函数可以读取调用者的变量。所以函数中可以使用的变量包括：
+//   - 自己的参数和自己赋值过的变量
+//   - start 中赋值过的变量（全局变量）和宿主程序设置的全局变量
+//   - 调用它的函数（直接或间接）中可以使用的变量
+//   - 内置常量，例如 pi
+//
+// 解析的结果会缓存在函数调用表达式中，运行时不再逐层查找函数。
+
+// 名字解析发现的问题
+type ResolveError struct {
+	Line int
+	Func string // 所在的函数
+	Msg  string
+
+	detail lazyText // 按语言生成 Msg
+	lang   Lang
+}
+
+func (e *ResolveError) Error() string {
+	return e.inLang(e.lang)
+}
+
+func (e *ResolveError) inLang(l Lang) string {
+	m := e.Msg
+	if e.detail != nil {
+		m = e.detail(l)
+	}
+	return format(l, msgResolveError, []any{e.Line, m, e.Func})
+}
+
+func (e *ResolveError) setLang(l Lang) {
+	e.lang = l
+	if e.detail != nil {
+		e.Msg = e.detail(l)
+	}
+}
+
+// 名字解析发现的所有问题，按行号排序
+type ResolveErrors []*ResolveError
+
+func (e ResolveErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e ResolveErrors) inLang(l Lang) string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.inLang(l)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e ResolveErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+type resolver struct {
+	h       *HerCodeInterpreter
+	visible map[string]map[string]bool // 每个函数可以使用的变量
+	errs    ResolveErrors
+}
+
+// 按当前注册的函数和全局变量重新检查脚本中的名字，有问题时返回 ResolveErrors。
+// Parse 结束时已经检查过一次；在 Parse 之后才注册的宿主函数和全局变量会被 Parse 报告为未定义，
+// 注册完之后调用 Resolve 即可重新检查
+func (h *HerCodeInterpreter) Resolve() error {
+	return h.localize(h.resolve())
+}
+
+// 解析所有函数中的名字，有问题时返回 ResolveErrors
+func (h *HerCodeInterpreter) resolve() error {
+	r := &resolver{
+		h:       h,
+		visible: make(map[string]map[string]bool),
+	}
+	funcs := h.GlobalCtx.Functions
+
+	// 全局变量：start 中赋值的变量和宿主程序设置的变量
+	globals := map[string]bool{}
+	for name := range h.GlobalCtx.Variables {
+		globals[name] = true
+	}
+	if start, ok := funcs["start"]; ok {
+		assignedVars(start.Statements, globals)
+	}
+
+	// 调用关系：calls[f] 是 f 调用的用户函数
+	calls := make(map[string][]string)
+	for name, fn := range funcs {
+		own := map[string]bool{}
+		for _, p := range fn.Parameters {
+			own[p] = true
+		}
+		assignedVars(fn.Statements, own)
+
+		visible := map[string]bool{}
+		for v := range own {
+			visible[v] = true
+		}
+		for v := range globals {
+			visible[v] = true
+		}
+		r.visible[name] = visible
+
+		walkCalls(fn.Statements, func(callee string) {
+			if _, ok := funcs[callee]; ok {
+				calls[name] = append(calls[name], callee)
+			}
+		})
+	}
+
+	// 调用者可以使用的变量，被调用的函数也可以使用，直到不再变化
+	for changed := true; changed; {
+		changed = false
+		for caller, callees := range calls {
+			for _, callee := range callees {
+				for v := range r.visible[caller] {
+					if !r.visible[callee][v] {
+						r.visible[callee][v] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for name, fn := range funcs {
+		r.stmts(name, fn.Statements)
+	}
+	if len(r.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(r.errs, func(i, j int) bool {
+		if r.errs[i].Line != r.errs[j].Line {
+			return r.errs[i].Line < r.errs[j].Line
+		}
+		return r.errs[i].Msg < r.errs[j].Msg
+	})
+	return r.errs
+}
+
+func (r *resolver) errorf(fn string, line int, id msgID, args ...any) {
+	detail := lazyMsg(id, args...)
+	r.errs = append(r.errs, &ResolveError{Line: line, Func: fn, Msg: detail(r.h.lang), detail: detail, lang: r.h.lang})
+}
+
+func (r *resolver) stmts(fn string, stmts []Statement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *SayStmt:
+			r.expr(fn, s.Expr)
+		case *AssignStmt:
+			r.expr(fn, s.Expr)
+		case *VarDeclStmt:
+			r.expr(fn, s.Expr)
+		case *AskStmt:
+			r.expr(fn, s.Prompt)
+		case *ReturnStmt:
+			r.expr(fn, s.Expr)
+		case *IfStmt:
+			r.expr(fn, s.Condition)
+			r.stmts(fn, s.ThenBranch)
+			r.stmts(fn, s.ElseBranch)
+		case *WhileStmt:
+			r.expr(fn, s.Condition)
+			r.stmts(fn, s.Body)
+		case *FuncCallStmt:
+			r.call(fn, s.callExpr())
+		}
+	}
+}
+
+func (r *resolver) expr(fn string, expr Expression) {
+	switch e := expr.(type) {
+	case *VarRefExpr:
+		if r.visible[fn][e.Name] {
+			return
+		}
+		if _, ok := builtinConstants[e.Name]; ok {
+			return
+		}
+		r.errorf(fn, e.Line, msgUndefinedVar, e.Name, didYouMean(e.Name, sortedNames(r.visible[fn]), constantNames()))
+	case *BinOpExpr:
+		if _, isAssign := e.Left.(*VarRefExpr); !isAssign || e.Operator != "=" {
+			r.expr(fn, e.Left)
+		}
+		r.expr(fn, e.Right)
+	case *FuncCallExpr:
+		r.call(fn, e)
+	}
+}
+
+// 解析函数调用，检查参数个数，并缓存调用的用户函数
+func (r *resolver) call(fn string, e *FuncCallExpr) {
+	for _, arg := range e.Arguments {
+		r.expr(fn, arg)
+	}
+
+	n := len(e.Arguments)
+	if target, ok := r.h.GlobalCtx.Functions[e.Name]; ok {
+		e.fn, e.resolved = target, true
+		if n != len(target.Parameters) {
+			r.errorf(fn, e.Line, msgArity, e.Name, len(target.Parameters), n)
+		}
+		return
+	}
+	if b, ok := r.h.Builtins[e.Name]; ok {
+		// 内置函数可以在 Parse 之后重新注册，运行时再查找
+		if n < b.MinArgs || (!b.Variadic && n > len(b.Params)) {
+			r.errorf(fn, e.Line, msgArity, e.Name, b.arity(), n)
+		}
+		return
+	}
+	r.errorf(fn, e.Line, msgUndefinedFunc, e.Name, didYouMean(e.Name, r.h.GlobalCtx.funcNames(), keywords))
+}
+
+// 遍历语句中调用的函数名
+func walkCalls(stmts []Statement, visit func(name string)) {
+	var expr func(e Expression)
+	expr = func(e Expression) {
+		switch e := e.(type) {
+		case *BinOpExpr:
+			expr(e.Left)
+			expr(e.Right)
+		case *FuncCallExpr:
+			visit(e.Name)
+			for _, arg := range e.Arguments {
+				expr(arg)
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *SayStmt:
+			expr(s.Expr)
+		case *AssignStmt:
+			expr(s.Expr)
+		case *VarDeclStmt:
+			expr(s.Expr)
+		case *AskStmt:
+			expr(s.Prompt)
+		case *ReturnStmt:
+			expr(s.Expr)
+		case *IfStmt:
+			expr(s.Condition)
+			walkCalls(s.ThenBranch, visit)
+			walkCalls(s.ElseBranch, visit)
+		case *WhileStmt:
+			expr(s.Condition)
+			walkCalls(s.Body, visit)
+		case *FuncCallStmt:
+			visit(s.Name)
+			for _, arg := range s.Arguments {
+				expr(arg)
+			}
+		}
+	}
+}
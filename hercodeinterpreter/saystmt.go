@@ -1,6 +1,11 @@
 package hercodeinterpreter
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 // Say语句
 type SayStmt struct {
@@ -11,24 +16,74 @@ func (s *SayStmt) String() string {
 	return fmt.Sprintf("say %v", s.Expr.String())
 }
 func (s *SayStmt) Execute(ctx *Context) (Value, error) {
+	if err := ctx.step(); err != nil {
+		return Value{}, err
+	}
+
 	val, err := s.Expr.Eval(ctx)
 	if err != nil {
 		return Value{}, err
 	}
 
+	if err := say(ctx, val); err != nil {
+		return Value{}, err
+	}
+	return Value{Type: VoidType}, nil
+}
+
+// 输出一个值，错误值输出到错误输出并记录下来，树遍历解释器和字节码虚拟机共用
+func say(ctx *Context, val Value) error {
 	if val.Type == ErrorType {
-		fmt.Printf("错误: %v\n", val.Error)
-	} else {
-		switch val.Type {
-		case NumberType:
-			fmt.Println(val.Num)
-		case StringType:
-			fmt.Println(val.Str)
-		case BoolType:
-			fmt.Println(val.Bool)
-		default:
-			fmt.Println()
+		if ctx.interp != nil {
+			ctx.interp.run.printedErrors++
 		}
+		fmt.Fprintln(ctx.Stderr(), format(ctx.language(), msgSayError, []any{val.Error}))
+		return nil
 	}
-	return Value{Type: VoidType}, nil
+
+	var err error
+	out := ctx.Stdout()
+	switch val.Type {
+	case NumberType:
+		_, err = fmt.Fprintln(out, val.Num)
+	case StringType:
+		_, err = fmt.Fprintln(out, val.Str)
+	case BoolType:
+		_, err = fmt.Fprintln(out, val.Bool)
+	case SliceType, MapType:
+		_, err = fmt.Fprintln(out, sayItem(val))
+	default:
+		_, err = fmt.Fprintln(out)
+	}
+	return err
+}
+
+// 列表和字典中的值按源代码的写法输出：字符串带引号，字典按键排序，例如 ["a", 1, {"k": true}]
+func sayItem(val Value) string {
+	switch val.Type {
+	case NumberType:
+		return fmt.Sprint(val.Num)
+	case StringType:
+		return strconv.Quote(val.Str)
+	case BoolType:
+		return strconv.FormatBool(val.Bool)
+	case SliceType:
+		items := make([]string, len(val.Slice))
+		for i, item := range val.Slice {
+			items[i] = sayItem(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case MapType:
+		keys := make([]string, 0, len(val.Map))
+		for k := range val.Map {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, k := range keys {
+			items[i] = strconv.Quote(k) + ": " + sayItem(val.Map[k])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return val.String()
 }
@@ -0,0 +1,77 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// say 按源代码的写法输出列表和字典，两种执行方式相同
+func TestSayListsAndMaps(t *testing.T) {
+	const src = `start:
+    say args
+    say split("a b", " ")
+    say scores
+    say empty
+end
+`
+	const want = `["alice", "3", "中文"]
+["a", "b"]
+{"ann": [90, 85.5], "bob": {"ok": true}}
+[]
+`
+	for _, vm := range []bool{false, true} {
+		var out bytes.Buffer
+		h := NewHerCodeInterpreter(WithStdout(&out), WithArgs("alice", "3", "中文"), WithVM(vm))
+		err := h.SetGlobal("scores", map[string]any{
+			"bob": map[string]bool{"ok": true},
+			"ann": []float64{90, 85.5},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.SetGlobal("empty", []string{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Parse(src); err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		mustExecute(t, h)
+		if got := out.String(); got != want {
+			t.Errorf("vm=%v: output\n%s\nwant\n%s", vm, got, want)
+		}
+	}
+}
+
+// say 一个错误值时错误输出到 Stderr，执行继续，PrintedErrors 记录下来
+func TestSayErrorIsCounted(t *testing.T) {
+	const src = `start:
+    say 1 + true
+    say arg(5)
+    say "after"
+end
+`
+	for _, vm := range []bool{false, true} {
+		var out, errOut bytes.Buffer
+		h := NewHerCodeInterpreter(WithStdout(&out), WithStderr(&errOut), WithVM(vm), WithLang(LangEN))
+		if err := h.Parse(src); err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if _, errs := h.Execute(context.Background()); len(errs) != 3 {
+			t.Fatalf("vm=%v: Execute returned %d results, want 3", vm, len(errs))
+		}
+		if got := h.PrintedErrors(); got != 2 {
+			t.Errorf("vm=%v: PrintedErrors = %d, want 2\nstderr:\n%s", vm, got, errOut.String())
+		}
+		if out.String() != "after\n" {
+			t.Errorf("vm=%v: output = %q, want %q", vm, out.String(), "after\n")
+		}
+
+		// 下一次执行重新计数
+		h.Parse("start:\n    say 1\nend\n")
+		mustExecute(t, h)
+		if got := h.PrintedErrors(); got != 0 {
+			t.Errorf("vm=%v: PrintedErrors after a clean run = %d, want 0", vm, got)
+		}
+	}
+}
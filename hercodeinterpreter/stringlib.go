@@ -0,0 +1,285 @@
+package hercodeinterpreter
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ==================== 字符串标准库 ====================
+// 所有下标和长度都按字符（rune）计算，而不是按字节，
+// 这样 len("你好") 是 2 而不是 6。
+
+func init() {
+	str := param("str", StringType)
+	registerBuiltin(&Builtin{Name: "len", Params: []Param{param("x", StringType, SliceType, MapType)}, MinArgs: 1, Fn: builtinLen})
+	registerBuiltin(&Builtin{Name: "substr", Params: []Param{str, param("start", NumberType), param("end", NumberType)}, MinArgs: 2, Fn: builtinSubstr})
+	registerBuiltin(&Builtin{Name: "upper", Params: []Param{str}, MinArgs: 1, Fn: builtinUpper})
+	registerBuiltin(&Builtin{Name: "lower", Params: []Param{str}, MinArgs: 1, Fn: builtinLower})
+	registerBuiltin(&Builtin{Name: "trim", Params: []Param{str, param("chars", StringType)}, MinArgs: 1, Fn: builtinTrim})
+	registerBuiltin(&Builtin{Name: "split", Params: []Param{str, param("sep", StringType)}, MinArgs: 1, Fn: builtinSplit})
+	registerBuiltin(&Builtin{Name: "join", Params: []Param{param("list", SliceType), param("sep", StringType)}, MinArgs: 1, Fn: builtinJoin})
+	registerBuiltin(&Builtin{Name: "replace", Params: []Param{str, param("old", StringType), param("new", StringType), param("n", NumberType)}, MinArgs: 3, Fn: builtinReplace})
+	registerBuiltin(&Builtin{Name: "contains", Params: []Param{str, param("sub", StringType)}, MinArgs: 2, Fn: builtinContains})
+	registerBuiltin(&Builtin{Name: "starts_with", Params: []Param{str, param("prefix", StringType)}, MinArgs: 2, Fn: builtinStartsWith})
+	registerBuiltin(&Builtin{Name: "ends_with", Params: []Param{str, param("suffix", StringType)}, MinArgs: 2, Fn: builtinEndsWith})
+	registerBuiltin(&Builtin{Name: "index_of", Params: []Param{str, param("sub", StringType)}, MinArgs: 2, Fn: builtinIndexOf})
+	registerBuiltin(&Builtin{Name: "repeat", Params: []Param{str, param("n", NumberType)}, MinArgs: 2, Fn: builtinRepeat})
+	registerBuiltin(&Builtin{Name: "reverse", Params: []Param{param("x", StringType, SliceType)}, MinArgs: 1, Fn: builtinReverse})
+	registerBuiltin(&Builtin{Name: "pad_left", Params: []Param{str, param("width", NumberType), param("fill", StringType)}, MinArgs: 2, Fn: builtinPadLeft})
+	registerBuiltin(&Builtin{Name: "pad_right", Params: []Param{str, param("width", NumberType), param("fill", StringType)}, MinArgs: 2, Fn: builtinPadRight})
+	registerBuiltin(&Builtin{Name: "format", Params: []Param{param("template", StringType), param("args")}, MinArgs: 1, Variadic: true, Fn: builtinFormat})
+}
+
+// len(x) 返回字符串的字符数，或列表、字典的元素个数
+func builtinLen(ctx *Context, args []Value) (Value, error) {
+	switch args[0].Type {
+	case SliceType:
+		return Value{Type: NumberType, Num: float64(len(args[0].Slice))}, nil
+	case MapType:
+		return Value{Type: NumberType, Num: float64(len(args[0].Map))}, nil
+	}
+	return Value{Type: NumberType, Num: float64(utf8.RuneCountInString(args[0].Str))}, nil
+}
+
+// substr(str, start[, end]) 返回 [start, end) 之间的子串
+func builtinSubstr(ctx *Context, args []Value) (Value, error) {
+	start, err := argInt("substr", args, 1)
+	if err != nil {
+		return Value{}, err
+	}
+	runes := []rune(args[0].Str)
+	if start < 0 || start >= len(runes) {
+		return Value{}, errorf(msgSubstrStart)
+	}
+
+	end := len(runes)
+	if len(args) == 3 {
+		end, err = argInt("substr", args, 2)
+		if err != nil {
+			return Value{}, err
+		}
+		if end < start || end > len(runes) {
+			return Value{}, errorf(msgSubstrEnd)
+		}
+	}
+	return Value{Type: StringType, Str: string(runes[start:end])}, nil
+}
+
+func builtinUpper(ctx *Context, args []Value) (Value, error) {
+	return Value{Type: StringType, Str: strings.ToUpper(args[0].Str)}, nil
+}
+
+func builtinLower(ctx *Context, args []Value) (Value, error) {
+	return Value{Type: StringType, Str: strings.ToLower(args[0].Str)}, nil
+}
+
+// trim(str[, chars]) 去掉首尾空白，或去掉首尾出现在 chars 中的字符
+func builtinTrim(ctx *Context, args []Value) (Value, error) {
+	if len(args) == 1 {
+		return Value{Type: StringType, Str: strings.TrimSpace(args[0].Str)}, nil
+	}
+	return Value{Type: StringType, Str: strings.Trim(args[0].Str, args[1].Str)}, nil
+}
+
+// split(str[, sep]) 按分隔符切分字符串；不给分隔符时按空白切分，分隔符为 "" 时切成单个字符
+func builtinSplit(ctx *Context, args []Value) (Value, error) {
+	var parts []string
+	if len(args) == 1 {
+		parts = strings.Fields(args[0].Str)
+	} else {
+		parts = strings.Split(args[0].Str, args[1].Str)
+	}
+
+	list := make([]Value, len(parts))
+	for i, p := range parts {
+		list[i] = Value{Type: StringType, Str: p}
+	}
+	return Value{Type: SliceType, Slice: list}, nil
+}
+
+// join(list[, sep]) 用分隔符把列表元素连接成字符串
+func builtinJoin(ctx *Context, args []Value) (Value, error) {
+	sep := ""
+	if len(args) == 2 {
+		sep = args[1].Str
+	}
+
+	parts := make([]string, len(args[0].Slice))
+	for i, v := range args[0].Slice {
+		parts[i] = v.String()
+	}
+	return Value{Type: StringType, Str: strings.Join(parts, sep)}, nil
+}
+
+// replace(str, old, new[, n]) 把 old 替换为 new，n 为替换次数，默认全部替换
+func builtinReplace(ctx *Context, args []Value) (Value, error) {
+	n := -1
+	if len(args) == 4 {
+		var err error
+		if n, err = argInt("replace", args, 3); err != nil {
+			return Value{}, err
+		}
+	}
+	return Value{Type: StringType, Str: strings.Replace(args[0].Str, args[1].Str, args[2].Str, n)}, nil
+}
+
+func builtinContains(ctx *Context, args []Value) (Value, error) {
+	return Value{Type: BoolType, Bool: strings.Contains(args[0].Str, args[1].Str)}, nil
+}
+
+func builtinStartsWith(ctx *Context, args []Value) (Value, error) {
+	return Value{Type: BoolType, Bool: strings.HasPrefix(args[0].Str, args[1].Str)}, nil
+}
+
+func builtinEndsWith(ctx *Context, args []Value) (Value, error) {
+	return Value{Type: BoolType, Bool: strings.HasSuffix(args[0].Str, args[1].Str)}, nil
+}
+
+// index_of(str, sub) 返回 sub 第一次出现的字符位置，找不到返回 -1
+func builtinIndexOf(ctx *Context, args []Value) (Value, error) {
+	s := args[0].Str
+	i := strings.Index(s, args[1].Str)
+	if i < 0 {
+		return Value{Type: NumberType, Num: -1}, nil
+	}
+	return Value{Type: NumberType, Num: float64(utf8.RuneCountInString(s[:i]))}, nil
+}
+
+// repeat 生成的最多字节数和 pad_left / pad_right 补足后的最多字符数。
+// 没有设置 MaxStringBytes 时，脚本也不能因为次数或宽度太大耗尽内存
+const maxBuiltString = 1 << 24
+
+func builtinRepeat(ctx *Context, args []Value) (Value, error) {
+	n, err := argInt("repeat", args, 1)
+	if err != nil {
+		return Value{}, err
+	}
+	if n < 0 {
+		return Value{}, errorf(msgRepeatNegative)
+	}
+	if s := args[0].Str; s != "" {
+		if n > maxBuiltString/len(s) {
+			return Value{}, errorf(msgRepeatTooLarge)
+		}
+		if err := ctx.checkStringBytes(len(s) * n); err != nil {
+			return Value{}, err
+		}
+	}
+	return Value{Type: StringType, Str: strings.Repeat(args[0].Str, n)}, nil
+}
+
+// reverse(x) 反转字符串中的字符，或反转列表
+func builtinReverse(ctx *Context, args []Value) (Value, error) {
+	if args[0].Type == SliceType {
+		n := len(args[0].Slice)
+		list := make([]Value, n)
+		for i, v := range args[0].Slice {
+			list[n-1-i] = v
+		}
+		return Value{Type: SliceType, Slice: list}, nil
+	}
+
+	runes := []rune(args[0].Str)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return Value{Type: StringType, Str: string(runes)}, nil
+}
+
+func builtinPadLeft(ctx *Context, args []Value) (Value, error) {
+	return pad(ctx, "pad_left", args, true)
+}
+
+func builtinPadRight(ctx *Context, args []Value) (Value, error) {
+	return pad(ctx, "pad_right", args, false)
+}
+
+// pad(str, width[, fill]) 用 fill（默认空格）把字符串补足到 width 个字符
+func pad(ctx *Context, name string, args []Value, left bool) (Value, error) {
+	s := args[0].Str
+	width, err := argInt(name, args, 1)
+	if err != nil {
+		return Value{}, err
+	}
+	fill := " "
+	if len(args) == 3 {
+		fill = args[2].Str
+		if fill == "" {
+			return Value{}, errorf(msgEmptyPad, name)
+		}
+	}
+
+	if width > maxBuiltString {
+		return Value{}, errorf(msgPadTooWide, name, maxBuiltString)
+	}
+	missing := width - utf8.RuneCountInString(s)
+	if missing <= 0 {
+		return Value{Type: StringType, Str: s}, nil
+	}
+	if err := ctx.checkStringBytes(len(s) + missing); err != nil {
+		return Value{}, err
+	}
+	fillRunes := []rune(fill)
+	padding := make([]rune, missing)
+	for i := range padding {
+		padding[i] = fillRunes[i%len(fillRunes)]
+	}
+	if left {
+		return Value{Type: StringType, Str: string(padding) + s}, nil
+	}
+	return Value{Type: StringType, Str: s + string(padding)}, nil
+}
+
+// format(template, args...) 用参数依次替换模板中的 {}，{0} {1} 按位置替换，{{ 和 }} 表示花括号本身
+func builtinFormat(ctx *Context, args []Value) (Value, error) {
+	values := args[1:]
+
+	var r strings.Builder
+	next := 0
+	runes := []rune(args[0].Str)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if c == '}' {
+			if i+1 < len(runes) && runes[i+1] == '}' {
+				i++
+			}
+			r.WriteRune('}')
+			continue
+		}
+		if c != '{' {
+			r.WriteRune(c)
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == '{' {
+			r.WriteRune('{')
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && runes[end] != '}' {
+			end++
+		}
+		if end == len(runes) {
+			return Value{}, errorf(msgFormatUnclosed)
+		}
+
+		index := next
+		if key := string(runes[i+1 : end]); key != "" {
+			n, err := strconv.Atoi(key)
+			if err != nil {
+				return Value{}, errorf(msgFormatBadPlaceholder, key)
+			}
+			index = n
+		} else {
+			next++
+		}
+		if index < 0 || index >= len(values) {
+			return Value{}, errorf(msgFormatMissingArg, index+1)
+		}
+		r.WriteString(values[index].String())
+		i = end
+	}
+	return Value{Type: StringType, Str: r.String()}, nil
+}
@@ -0,0 +1,38 @@
+package hercodeinterpreter
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// 宽度或次数太大、不是有限的整数时 pad_left / pad_right / repeat 返回错误值，而不是分配内存时让整个进程崩溃
+func TestHugePadAndRepeat(t *testing.T) {
+	const src = `start:
+    say pad_left("x", 1e15)
+    say pad_right("x", 1e300 * 1e300)
+    say pad_left("x", 0 - 1e300 * 1e300)
+    say pad_right("x", 1e19)
+    say repeat("ab", 1e15)
+    say pad_left("x", 3, ".")
+end
+`
+	for _, vm := range []bool{false, true} {
+		var out, errOut bytes.Buffer
+		h := NewHerCodeInterpreter(WithStdout(&out), WithStderr(&errOut), WithVM(vm), WithLang(LangEN))
+		if err := h.Parse(src); err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		h.Execute(context.Background())
+		if got := h.PrintedErrors(); got != 5 {
+			t.Errorf("vm=%v: PrintedErrors = %d, want 5\nstderr:\n%s", vm, got, errOut.String())
+		}
+		if !strings.Contains(errOut.String(), "pad_left() width is too large") {
+			t.Errorf("vm=%v: stderr = %q, want the width error", vm, errOut.String())
+		}
+		if out.String() != "..x\n" {
+			t.Errorf("vm=%v: output = %q, want %q", vm, out.String(), "..x\n")
+		}
+	}
+}
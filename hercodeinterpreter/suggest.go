@@ -0,0 +1,129 @@
+package hercodeinterpreter
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+// ==================== 拼写建议 ====================
+// 遇到未定义的名字或无法解析的语句时，从作用域中的变量、定义过的函数、内置函数和关键字中
+// 找出最接近的名字，附加在错误信息后面，例如：函数未定义: sya，你是不是想写 say？
+
+// 语言的关键字
+var keywords = []string{
+	"say", "var", "if", "else", "endif", "while", "endwhile",
+	"function", "start", "end", "return", "ask", "into", "true", "false",
+}
+
+// 拼写建议，找不到足够接近的名字时为空
+func didYouMean(name string, candidates ...[]string) lazyText {
+	if s := closestName(name, candidates...); s != "" {
+		return lazyMsg(msgDidYouMean, s)
+	}
+	return func(Lang) string { return "" }
+}
+
+// 在所有候选名字中找出与 name 编辑距离最小的一个，距离相同时取字典序最小的。
+// 名字越长允许的差别越大，每三个字符允许错一个；一两个字符的名字不给建议。
+func closestName(name string, candidates ...[]string) string {
+	limit := len([]rune(name)) / 3
+	best, bestDist := "", limit+1
+	for _, list := range candidates {
+		for _, c := range list {
+			if c == name {
+				continue
+			}
+			d := editDistance(name, c)
+			if d < bestDist || (d == bestDist && c < best) {
+				best, bestDist = c, d
+			}
+		}
+	}
+	return best
+}
+
+// 编辑距离：插入、删除、替换一个字符或交换相邻两个字符都算一步，
+// 所以 endwhlie 与 endwhile 的距离是 1
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] 是 s[:i] 与 t[:j] 的距离
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// 作用域中所有可以使用的变量名，包括内置常量
+func (c *Context) varNames() []string {
+	seen := map[string]bool{}
+	for ctx := c; ctx != nil; ctx = ctx.Parent {
+		for name := range ctx.Variables {
+			seen[name] = true
+		}
+	}
+	return append(sortedNames(seen), constantNames()...)
+}
+
+// 所有的关键字（英文写法），供编辑器补全等工具使用
+func Keywords() []string {
+	return slices.Clone(keywords)
+}
+
+// 所有的内置常量，例如 pi
+func Constants() map[string]Value {
+	return maps.Clone(builtinConstants)
+}
+
+// 内置常量的名字
+func constantNames() []string {
+	seen := map[string]bool{}
+	for name := range builtinConstants {
+		seen[name] = true
+	}
+	return sortedNames(seen)
+}
+
+// 所有定义过的函数名和内置函数名
+func (c *Context) funcNames() []string {
+	seen := map[string]bool{}
+	for ctx := c; ctx != nil; ctx = ctx.Parent {
+		for name := range ctx.Functions {
+			seen[name] = true
+		}
+	}
+	table := defaultBuiltins
+	if c.interp != nil {
+		table = c.interp.Builtins
+	}
+	for name := range table {
+		seen[name] = true
+	}
+	return sortedNames(seen)
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
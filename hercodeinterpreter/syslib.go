@@ -0,0 +1,87 @@
+package hercodeinterpreter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ==================== 系统标准库 ====================
+// 脚本通过 args 列表读取命令行参数，用 exit 结束运行并设定进程的退出码，
+// 这样 HerCode 脚本也可以用在 shell 管道和 Makefile 中。
+
+// 脚本调用 exit 时返回的错误，会立即停止整个执行
+type ExitError struct {
+	Code int
+	lang Lang
+}
+
+func (e *ExitError) Error() string {
+	return e.inLang(e.lang)
+}
+
+func (e *ExitError) inLang(l Lang) string {
+	return format(l, msgExit, []any{e.Code})
+}
+
+func (e *ExitError) setLang(l Lang) {
+	e.lang = l
+}
+
+// 设置命令行参数，脚本中的 args 是由这些字符串组成的列表
+func WithArgs(args ...string) Option {
+	return func(h *HerCodeInterpreter) { h.Args = args }
+}
+
+func init() {
+	registerBuiltin(&Builtin{Name: "exit", Params: []Param{param("code", NumberType)}, Fn: builtinExit})
+	registerBuiltin(&Builtin{Name: "arg", Params: []Param{param("index", NumberType), param("default", StringType, NumberType)}, MinArgs: 1, Fn: builtinArg})
+}
+
+// args 列表的值
+func argsValue(args []string) Value {
+	list := make([]Value, len(args))
+	for i, arg := range args {
+		list[i] = Value{Type: StringType, Str: arg}
+	}
+	return Value{Type: SliceType, Slice: list}
+}
+
+// exit([code]) 结束运行，code 默认为 0
+func builtinExit(ctx *Context, args []Value) (Value, error) {
+	code := 0
+	if len(args) == 1 {
+		n, err := argInt("exit", args, 0)
+		if err != nil || n < 0 || n > 255 {
+			return Value{}, errorf(msgExitCode)
+		}
+		code = n
+	}
+	return Value{}, &ExitError{Code: code}
+}
+
+// arg(index, [default]) 第 index 个命令行参数（从 0 开始）。
+// 没有这个参数时返回 default；default 是数字时，参数也转换为数字
+func builtinArg(ctx *Context, args []Value) (Value, error) {
+	i, err := argInt("arg", args, 0)
+	if err != nil {
+		return Value{}, err
+	}
+	var list []string
+	if ctx.interp != nil {
+		list = ctx.interp.Args
+	}
+	if i < 0 || i >= len(list) {
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return Value{}, errorf(msgArgMissing, i)
+	}
+	if len(args) == 2 && args[1].Type == NumberType {
+		n, err := strconv.ParseFloat(strings.TrimSpace(list[i]), 64)
+		if err != nil {
+			return Value{}, errorf(msgArgNotNumber, i, list[i])
+		}
+		return Value{Type: NumberType, Num: n}, nil
+	}
+	return Value{Type: StringType, Str: list[i]}, nil
+}
@@ -0,0 +1,18 @@
+package hercodeinterpreter
+
+// ==================== 测试标准库 ====================
+
+func init() {
+	registerBuiltin(&Builtin{Name: "assert", Params: []Param{param("cond", BoolType), param("message")}, MinArgs: 1, Fn: builtinAssert})
+}
+
+// assert(cond, [message]) 条件不成立时返回错误，hercode test 把它报告为测试失败
+func builtinAssert(ctx *Context, args []Value) (Value, error) {
+	if args[0].Bool {
+		return Value{Type: VoidType}, nil
+	}
+	if len(args) == 2 {
+		return Value{}, errorf(msgAssertFailedMsg, args[1])
+	}
+	return Value{}, errorf(msgAssertFailed)
+}
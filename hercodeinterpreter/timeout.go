@@ -0,0 +1,38 @@
+package hercodeinterpreter
+
+import "context"
+
+// 执行超时或被取消时返回的错误
+type TimeoutError struct {
+	Line  int    // 被中断的 while 循环所在行，0 表示不是在循环中被中断
+	Func  string // 被中断时正要调用的函数
+	Cause error  // context.DeadlineExceeded 或 context.Canceled
+	lang  Lang
+}
+
+func (e *TimeoutError) Error() string {
+	return e.inLang(e.lang)
+}
+
+func (e *TimeoutError) inLang(l Lang) string {
+	what := format(l, msgTimeout, nil)
+	if e.Cause == context.Canceled {
+		what = format(l, msgCanceled, nil)
+	}
+	switch {
+	case e.Line > 0:
+		return format(l, msgLoopInterrupted, []any{e.Line, what})
+	case e.Func != "":
+		return format(l, msgCallInterrupted, []any{e.Func, what})
+	default:
+		return what
+	}
+}
+
+func (e *TimeoutError) setLang(l Lang) {
+	e.lang = l
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Cause
+}
@@ -19,6 +19,33 @@ const (
 	ErrorType
 )
 
+func (t ValueType) String() string {
+	return t.inLang("")
+}
+
+func (t ValueType) inLang(l Lang) string {
+	id := msgTypeUnknown
+	switch t {
+	case NumberType:
+		id = msgTypeNumber
+	case StringType:
+		id = msgTypeString
+	case BoolType:
+		id = msgTypeBool
+	case VoidType:
+		id = msgTypeVoid
+	case SliceType:
+		id = msgTypeSlice
+	case MapType:
+		id = msgTypeMap
+	case FunctionType:
+		id = msgTypeFunction
+	case ErrorType:
+		id = msgTypeError
+	}
+	return format(l, id, nil)
+}
+
 // 值结构
 type Value struct {
 	Type  ValueType
@@ -28,6 +55,7 @@ type Value struct {
 	Slice []Value
 	Map   map[string]Value
 	Func  *HerCodeFunction
+	Host  *Builtin // 由 Go 宿主程序提供的函数
 	Error error
 }
 
@@ -55,7 +83,13 @@ func (e Value) String() string {
 		return "[" + strings.Join(s, ", ") + "]"
 
 	case FunctionType:
-		return fmt.Sprintf("%s", e.String())
+		switch {
+		case e.Func != nil:
+			return fmt.Sprintf("<函数 %s>", e.Func.Name)
+		case e.Host != nil:
+			return fmt.Sprintf("<函数 %s>", e.Host.Name)
+		}
+		return "<函数>"
 	default:
 		return ""
 
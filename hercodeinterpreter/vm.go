@@ -0,0 +1,454 @@
+package hercodeinterpreter
+
+import "context"
+
+// ==================== 字节码虚拟机 ====================
+// 栈式虚拟机，执行结果与树遍历解释器完全相同。
+// 每个函数调用占用一个栈帧，槽位和运算数都放在同一个值栈上：
+// stack[base : base+NumSlots] 是槽位，其上是运算数。
+// 变量仍然是动态作用域：槽位还没有赋值，或者变量不是局部变量时，按名字依次向调用者查找，
+// 最后查找全局变量。
+
+// 槽位还没有赋值时的标记
+const unsetType ValueType = -1
+
+// 使用字节码虚拟机执行（用于 Execute 和 Call）
+func WithVM(on bool) Option {
+	return func(h *HerCodeInterpreter) { h.UseVM = on }
+}
+
+type frame struct {
+	proto *Proto
+	pc    int
+	base  int
+}
+
+type vm struct {
+	h      *HerCodeInterpreter
+	prog   *Program
+	ctx    *Context
+	stack  []Value
+	frames []frame
+}
+
+// 编译后的程序，Parse 之后第一次使用时编译，可以用 EncodeProgram 保存为字节码文件
+func (h *HerCodeInterpreter) Program() (_ *Program, err error) {
+	defer func() { err = h.localize(err) }()
+	if h.program == nil {
+		prog, err := h.Compile()
+		if err != nil {
+			return nil, err
+		}
+		h.program = prog
+	}
+	return h.program, nil
+}
+
+func (h *HerCodeInterpreter) newVM(prog *Program) *vm {
+	return &vm{h: h, prog: prog, ctx: h.GlobalCtx, stack: make([]Value, 0, 256)}
+}
+
+// 用虚拟机执行 start 入口，与 Execute 的行为相同
+func (h *HerCodeInterpreter) executeVM(ctx context.Context) ([]Value, []error) {
+	prog, err := h.Program()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	defer h.beginRun(ctx)()
+
+	m := h.newVM(prog)
+	var errs []error
+	var vals []Value
+	for _, proto := range prog.Start {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, &TimeoutError{Cause: err})
+			break
+		}
+		val, err := m.run(proto, nil)
+		vals = append(vals, val)
+		errs = append(errs, err)
+		if isFatal(err) {
+			break
+		}
+	}
+	return vals, errs
+}
+
+// 用虚拟机调用用户函数
+func (h *HerCodeInterpreter) callVM(fn *Proto, args []Value) (Value, error) {
+	if err := h.GlobalCtx.Err(); err != nil {
+		return Value{}, &TimeoutError{Func: fn.Name, Cause: err}
+	}
+	if err := h.enterCallVM(fn.Name); err != nil {
+		return Value{}, err
+	}
+	return h.newVM(h.program).run(fn, args)
+}
+
+// 进入函数调用，超过 MaxCallDepth 时返回错误；退出时由 Return 减少调用层数
+func (h *HerCodeInterpreter) enterCallVM(name string) error {
+	if h.Limits.MaxCallDepth > 0 && h.run.depth >= h.Limits.MaxCallDepth {
+		return &LimitError{Err: ErrCallDepthLimit, Limit: int64(h.Limits.MaxCallDepth), Func: name}
+	}
+	h.run.depth++
+	return nil
+}
+
+// 计数一步，超过 MaxSteps 时返回错误
+func (m *vm) step() error {
+	h := m.h
+	h.run.steps++
+	if h.Limits.MaxSteps > 0 && h.run.steps > h.Limits.MaxSteps {
+		return &LimitError{Err: ErrStepLimit, Limit: h.Limits.MaxSteps}
+	}
+	return nil
+}
+
+func (m *vm) push(v Value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *vm) pop() Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+// 压入新栈帧，参数已经在栈顶
+func (m *vm) pushFrame(proto *Proto, argc int) {
+	base := len(m.stack) - argc
+	for argc < proto.Params {
+		m.push(Value{Type: VoidType})
+		argc++
+	}
+	m.stack = m.stack[:base+proto.Params]
+	for i := proto.Params; i < proto.NumSlots; i++ {
+		m.push(Value{Type: unsetType})
+	}
+	m.frames = append(m.frames, frame{proto: proto, base: base})
+}
+
+// 从第 fi 个栈帧开始按名字查找变量
+func (m *vm) lookup(fi int, name string) (Value, bool) {
+	for ; fi >= 0; fi-- {
+		f := &m.frames[fi]
+		if f.proto.Global {
+			break
+		}
+		if slot, ok := f.proto.slot(name); ok {
+			if v := m.stack[f.base+slot]; v.Type != unsetType {
+				return v, true
+			}
+		}
+	}
+	return m.ctx.GetVar(name)
+}
+
+// 从第 fi 层栈帧开始可以使用的所有变量名，与 lookup 的查找范围相同
+func (m *vm) varNames(fi int) []string {
+	seen := map[string]bool{}
+	for ; fi >= 0; fi-- {
+		f := &m.frames[fi]
+		if f.proto.Global {
+			break
+		}
+		for i, name := range f.proto.Locals {
+			if m.stack[f.base+i].Type != unsetType {
+				seen[name] = true
+			}
+		}
+	}
+	for _, name := range m.ctx.varNames() {
+		seen[name] = true
+	}
+	return sortedNames(seen)
+}
+
+// 执行 proto 直到它返回。函数的调用层数已经由调用者计入，返回时减少。
+func (m *vm) run(proto *Proto, args []Value) (result Value, err error) {
+	h := m.h
+	// 出错时直接退出所有栈帧，恢复调用层数
+	depth := h.run.depth
+	if !proto.Global {
+		depth--
+	}
+	defer func() {
+		if err != nil {
+			h.run.depth = depth
+		}
+	}()
+
+	m.stack = append(m.stack[:0], args...)
+	m.frames = m.frames[:0]
+	m.pushFrame(proto, len(args))
+
+	f := &m.frames[len(m.frames)-1]
+	code := f.proto.Code
+	for {
+		in := code[f.pc]
+		f.pc++
+
+		// 运行时错误：按当前语句的处理方式处理
+		var raised Value
+		switch in.Op {
+		case OpConst:
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+			m.push(f.proto.Consts[in.A])
+
+		case OpLoadLocal:
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+			v := m.stack[f.base+int(in.A)]
+			if v.Type == unsetType {
+				var ok bool
+				if v, ok = m.lookup(len(m.frames)-2, f.proto.Names[in.B]); !ok {
+					v, ok = builtinConstants[f.proto.Names[in.B]]
+				}
+				if !ok {
+					raised = Value{Type: ErrorType, Error: errorf(msgUndefinedVar, f.proto.Names[in.B], didYouMean(f.proto.Names[in.B], m.varNames(len(m.frames)-1)))}
+					break
+				}
+			}
+			m.push(v)
+
+		case OpLoadName:
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+			name := f.proto.Names[in.A]
+			v, ok := m.lookup(len(m.frames)-1, name)
+			if !ok {
+				v, ok = builtinConstants[name]
+			}
+			if !ok {
+				raised = Value{Type: ErrorType, Error: errorf(msgUndefinedVar, name, didYouMean(name, m.varNames(len(m.frames)-1)))}
+				break
+			}
+			m.push(v)
+
+		case OpStoreLocal:
+			m.stack[f.base+int(in.A)] = m.pop()
+
+		case OpStoreName:
+			m.ctx.SetVar(f.proto.Names[in.A], m.pop())
+
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpNe, OpLt, OpGt, OpLe, OpGe:
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+			n := len(m.stack)
+			left, right := m.stack[n-2], m.stack[n-1]
+			m.stack = m.stack[:n-2]
+			v, ok := numberOp(in.Op, left, right)
+			if !ok {
+				if v, err = binaryOp(m.ctx, binaryOperators[in.Op], left, right, int(in.B)); err != nil {
+					return Value{}, err
+				}
+				if v.Type == ErrorType {
+					raised = v
+					break
+				}
+			}
+			m.push(v)
+
+		case OpDup:
+			m.push(m.stack[len(m.stack)-1])
+
+		case OpStmt:
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+
+		case OpCheckFunc:
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+			if in.B == 0 {
+				if _, ok := h.Builtins[f.proto.Names[in.A]]; !ok {
+					raised = Value{Type: ErrorType, Error: errorf(msgUndefinedFunc, f.proto.Names[in.A], didYouMean(f.proto.Names[in.A], m.ctx.funcNames(), keywords))}
+				}
+			}
+
+		case OpCall:
+			callee := m.prog.Funcs[in.A]
+			if err := m.ctx.Err(); err != nil {
+				return Value{}, &TimeoutError{Func: callee.Name, Cause: err}
+			}
+			if err := h.enterCallVM(callee.Name); err != nil {
+				return Value{}, err
+			}
+			m.pushFrame(callee, int(in.B))
+			f = &m.frames[len(m.frames)-1]
+			code = f.proto.Code
+
+		case OpCallBuiltin:
+			n := len(m.stack) - int(in.B)
+			args := make([]Value, in.B)
+			copy(args, m.stack[n:])
+			m.stack = m.stack[:n]
+			b, ok := h.Builtins[f.proto.Names[in.A]]
+			if !ok {
+				raised = Value{Type: ErrorType, Error: errorf(msgUndefinedFunc, f.proto.Names[in.A], didYouMean(f.proto.Names[in.A], m.ctx.funcNames(), keywords))}
+				break
+			}
+			v, err := b.Call(m.ctx, args)
+			if err != nil {
+				return Value{}, err
+			}
+			if v.Type == ErrorType {
+				raised = v
+				break
+			}
+			m.push(v)
+
+		case OpJump:
+			f.pc = int(in.A)
+
+		case OpJumpIfFalse:
+			cond := m.pop()
+			if cond.Type != BoolType {
+				raised = Value{Type: ErrorType, Error: errorf(msgConditionNotBool)}
+				break
+			}
+			if !cond.Bool {
+				f.pc = int(in.A)
+			}
+
+		case OpLoopInit:
+			m.stack[f.base+f.proto.Loops[in.A].Slot] = Value{Type: VoidType}
+
+		case OpLoopEnter:
+			if err := m.ctx.Err(); err != nil {
+				return Value{}, &TimeoutError{Line: f.proto.Loops[in.A].Line, Cause: err}
+			}
+			if err := m.step(); err != nil {
+				return Value{}, err
+			}
+
+		case OpLoopCheck:
+			if err := m.checkLoop(f, &f.proto.Loops[in.A]); err != nil {
+				return Value{}, err
+			}
+
+		case OpSay:
+			if err := say(m.ctx, m.pop()); err != nil {
+				return Value{}, err
+			}
+
+		case OpAsk:
+			v, err := ask(m.ctx, m.pop(), f.proto.Names[in.A], in.B == 1)
+			if err != nil {
+				return Value{}, err
+			}
+			if v.Type == ErrorType {
+				raised = v
+				break
+			}
+			m.push(v)
+
+		case OpReturn, OpReturnIfSet:
+			v := m.pop()
+			if in.Op == OpReturnIfSet && v.Type == VoidType {
+				break
+			}
+			if done := m.ret(v); done {
+				return v, nil
+			}
+			f = &m.frames[len(m.frames)-1]
+			code = f.proto.Code
+			if v.Type == ErrorType {
+				// 被调用的函数返回了错误，在调用处继续处理
+				raised = v
+			}
+
+		default:
+			return Value{}, errorf(msgUnknownInstr, in.Op)
+		}
+
+		for raised.Type == ErrorType {
+			switch handler := f.proto.Handlers[f.pc-1]; handler {
+			case handleReturn:
+				if done := m.ret(raised); done {
+					return raised, nil
+				}
+				f = &m.frames[len(m.frames)-1]
+				code = f.proto.Code
+			case handleAbort:
+				return Value{}, raised.Error
+			default:
+				m.stack = m.stack[:f.base+f.proto.NumSlots]
+				if err := say(m.ctx, raised); err != nil {
+					return Value{}, err
+				}
+				f.pc = int(handler)
+				raised = Value{}
+			}
+		}
+	}
+}
+
+// 从当前栈帧返回 v，返回 true 表示已经回到 run 的入口
+func (m *vm) ret(v Value) bool {
+	f := m.frames[len(m.frames)-1]
+	m.frames = m.frames[:len(m.frames)-1]
+	if !f.proto.Global {
+		m.h.run.depth--
+	}
+	if len(m.frames) == 0 {
+		return true
+	}
+	m.stack = m.stack[:f.base]
+	m.push(v)
+	return false
+}
+
+// 新手模式下检测死循环，与 WhileStmt.Execute 相同
+func (m *vm) checkLoop(f *frame, loop *LoopInfo) error {
+	if !m.h.BeginnerMode || !loop.Pure || len(loop.Vars) == 0 {
+		return nil
+	}
+	fi := len(m.frames) - 1
+	now := make([]Value, len(loop.Vars))
+	for i, name := range loop.Vars {
+		now[i], _ = m.lookup(fi, name)
+	}
+	slot := &m.stack[f.base+loop.Slot]
+	if loop.NeverChanges || slot.Type == SliceType && snapshotsEqual(slot.Slice, now) {
+		return &InfiniteLoopError{Line: loop.Line, Vars: loop.Vars, first: now[0]}
+	}
+	*slot = Value{Type: SliceType, Slice: now}
+	return nil
+}
+
+// 两个数字之间的运算，不是两个数字或需要报错时 ok 为 false，交给 binaryOp 处理
+func numberOp(op Opcode, left, right Value) (v Value, ok bool) {
+	if left.Type != NumberType || right.Type != NumberType {
+		return Value{}, false
+	}
+	a, b := left.Num, right.Num
+	switch op {
+	case OpAdd:
+		return Value{Type: NumberType, Num: a + b}, true
+	case OpSub:
+		return Value{Type: NumberType, Num: a - b}, true
+	case OpMul:
+		return Value{Type: NumberType, Num: a * b}, true
+	case OpEq:
+		return Value{Type: BoolType, Bool: a == b}, true
+	case OpNe:
+		return Value{Type: BoolType, Bool: a != b}, true
+	case OpLt:
+		return Value{Type: BoolType, Bool: a < b}, true
+	case OpGt:
+		return Value{Type: BoolType, Bool: a > b}, true
+	case OpLe:
+		return Value{Type: BoolType, Bool: a <= b}, true
+	case OpGe:
+		return Value{Type: BoolType, Bool: a >= b}, true
+	}
+	return Value{}, false
+}
@@ -1,11 +1,109 @@
 package itype
 
-import "flag"
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// 子命令，不写子命令时与 run 相同
+var commands = map[string]bool{
+	"run":   true, // 运行脚本或字节码文件
+	"check": true, // 只检查语法和名字，不运行
+	"fmt":   true, // 格式化脚本
+	"lint":  true, // 静态检查，找出常见的错误
+	"ast":   true, // 输出语法树
+	"test":  true, // 运行 *_test.hc 中的测试函数
+	"build": true, // 把脚本编译成字节码文件
+	"repl":  true, // 进入交互模式
+	"lsp":   true, // 语言服务器，通过标准输入输出与编辑器通信
+}
+
+const usage = `Usage:
+  hercode [run] [flags] file.hc|file.hcb|- [args...]
+  hercode [run] [flags] -e 'code' [args...]
+  hercode check [flags] files...
+  hercode fmt [--check|--write] [flags] files...
+  hercode lint [flags] files...
+  hercode ast [flags] file
+  hercode test [flags] [files or directories...]
+  hercode build [flags] file.hc [-o file.hcb]
+  hercode repl [flags]
+  hercode lsp [flags]
+
+A file name of - reads the script from standard input. Arguments after the
+script name are passed to the script; use -- to pass arguments that start with -.
+
+Exit status: 0 on success, 1 on runtime errors, failed tests, unformatted files or lint problems,
+2 on usage errors or unreadable files, 3 on syntax or name errors.
+
+Flags:
+`
 
 func PaseFlag(F *Flag) {
+	args := os.Args[1:]
+	if len(args) > 0 && commands[args[0]] {
+		F.Command = args[0]
+		args = args[1:]
+	}
 
 	flag.StringVar(&F.FileName, "f", "", "file name")
+	flag.StringVar(&F.Code, "e", "", "run this code instead of a file; start: may be omitted")
 	flag.BoolVar(&F.Debug, "d", false, "debug mode")
-	flag.Parse()
+	flag.BoolVar(&F.Verbose, "v", false, "verbose mode, print compiling/running banners")
+	flag.DurationVar(&F.Timeout, "timeout", 0, "stop the script after this long, e.g. 5s (0 means no limit)")
+	flag.Int64Var(&F.Limits.MaxSteps, "max-steps", 0, "stop the script after this many statements and expressions (0 means no limit)")
+	flag.IntVar(&F.Limits.MaxCallDepth, "max-depth", 0, "maximum depth of nested function calls (0 means the default of 10000)")
+	flag.IntVar(&F.Limits.MaxString, "max-string", 0, "maximum size of a single string in bytes (0 means no limit)")
+	flag.IntVar(&F.Limits.MaxCollection, "max-list", 0, "maximum number of items in a single list or map (0 means no limit)")
+	flag.Int64Var(&F.Limits.MaxOutput, "max-output", 0, "maximum number of bytes the script may print (0 means no limit)")
+	flag.BoolVar(&F.Beginner, "beginner", false, "beginner mode, stop infinite loops with an explanation")
+	flag.BoolVar(&F.VM, "vm", false, "compile to bytecode and run it on the virtual machine")
+	flag.Int64Var(&F.Seed, "seed", 0, "random seed, makes random results reproducible (seeded from the clock if not given)")
+	flag.StringVar(&F.Output, "o", "", "output file for build, defaults to the script name with .hcb")
+	flag.StringVar(&F.Dialect, "dialect", "", "JSON file with aliases for keywords and built-in functions")
+	flag.BoolVar(&F.Check, "check", false, "fmt: list files that are not formatted and exit with status 1, without printing them")
+	flag.BoolVar(&F.Write, "write", false, "fmt: write the result back to the files instead of printing it")
+	flag.StringVar(&F.Lang, "lang", "", "language of error messages: zh or en (defaults to the LANG environment variable)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+	rest := flag.Args()
+	defer visitFlags(F)
+
+	// 运行时脚本名后面的参数都交给脚本，包括看起来像选项的参数
+	if F.Command == "" || F.Command == "run" {
+		if F.FileName == "" && F.Code == "" && len(rest) > 0 {
+			F.FileName, rest = rest[0], rest[1:]
+		}
+		if len(rest) > 0 && rest[0] == "--" {
+			rest = rest[1:]
+		}
+		F.Args = rest
+		return
+	}
+
+	// 其他子命令的文件名和选项可以交替出现，例如 hercode build foo.hc -o foo.hcb
+	if F.FileName != "" {
+		F.Files = append(F.Files, F.FileName)
+	}
+	for len(rest) > 0 {
+		F.Files = append(F.Files, rest[0])
+		flag.CommandLine.Parse(rest[1:])
+		rest = flag.Args()
+	}
+	if len(F.Files) > 0 {
+		F.FileName = F.Files[0]
+	}
+}
 
+// 记录命令行中明确给出的选项，用来区分 -seed 0 和没有给出 -seed
+func visitFlags(F *Flag) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			F.SeedSet = true
+		}
+	})
 }
@@ -1,6 +1,33 @@
 package itype
 
+import "time"
+
 type Flag struct {
-	FileName string
+	Command  string   // 子命令：run、check、fmt、ast、test、build 或 repl，为空时与 run 相同
+	FileName string   // 脚本文件，- 表示标准输入
+	Files    []string // run 以外的子命令可以处理多个文件
+	Code     string   // -e 给出的代码，代替脚本文件
+	Args     []string // 传给脚本的参数
 	Debug    bool
+	Seed     int64
+	SeedSet  bool // 命令行中给出了 -seed，包括 -seed 0
+	Verbose  bool
+	Timeout  time.Duration
+	Limits   Limits
+	Beginner bool
+	VM       bool
+	Output   string // build 的输出文件
+	Check    bool   // fmt 只检查文件是否已经格式化
+	Write    bool   // fmt 把结果写回文件
+	Lang     string // 错误信息的语言：zh 或 en，为空时由 LANG 环境变量决定
+	Dialect  string // 方言文件，给关键字和内置函数起别名
+}
+
+// 命令行给出的资源限制，0 表示使用解释器的默认值
+type Limits struct {
+	MaxSteps      int64
+	MaxCallDepth  int
+	MaxString     int
+	MaxCollection int
+	MaxOutput     int64
 }
@@ -0,0 +1,329 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+)
+
+// ==================== 文档分析 ====================
+// 文档每次打开或修改时重新分析一次：ParseTree 得到保留注释的语法树，用于大纲、跳转和悬停中的注释；
+// Parse 得到函数的签名（HerCodeFunction），有语法错误时出错之前定义的函数仍然可用；Lint 给出诊断。
+
+// 打开的文档和分析结果
+type document struct {
+	uri   string
+	text  string
+	lines []string // 按 \n 分开的各行，可能以 \r 结尾
+
+	h       *hercodeinterpreter.HerCodeInterpreter // 解析过文档的解释器
+	tree    *hercodeinterpreter.SyntaxTree         // 关键字语言包有冲突时为 nil
+	err     error                                  // 无法分析文档的原因
+	funcs   []*hercodeinterpreter.Node             // 函数和 start，按行号排列
+	source  map[int]*hercodeinterpreter.SourceLine // 行号 → 语法树中的一行
+	aliases map[string]string                      // 内置函数的别名 → 内置函数名
+}
+
+func newDocument(uri, src string, h *hercodeinterpreter.HerCodeInterpreter) *document {
+	d := &document{
+		uri:     uri,
+		text:    src,
+		lines:   strings.Split(src, "\n"),
+		h:       h,
+		source:  map[int]*hercodeinterpreter.SourceLine{},
+		aliases: map[string]string{},
+	}
+	d.tree, d.err = h.ParseTree(src)
+	if d.tree == nil {
+		return d
+	}
+	h.Parse(src) // 错误已经在语法树和诊断中
+
+	d.tree.Inspect(func(n *hercodeinterpreter.Node) bool {
+		d.source[n.Line.Num] = n.Line
+		return true
+	}, func(l *hercodeinterpreter.SourceLine) {
+		d.source[l.Num] = l
+	})
+	for _, n := range d.tree.Nodes {
+		if n.Kind == hercodeinterpreter.FuncNode || n.Kind == hercodeinterpreter.StartNode {
+			d.funcs = append(d.funcs, n)
+		}
+	}
+	for _, pack := range h.LanguagePacks {
+		for name, aliases := range pack.Builtins {
+			for _, alias := range aliases {
+				d.aliases[alias] = name
+			}
+		}
+	}
+	return d
+}
+
+// 检查文档，得到诊断
+func (d *document) diagnostics() []diagnostic {
+	diags := []diagnostic{}
+	if d.tree == nil {
+		return append(diags, diagnostic{Range: d.lineRange(1), Severity: severityError, Source: "hercode", Message: d.err.Error()})
+	}
+	found, err := d.h.Lint(d.text)
+	if err != nil {
+		return append(diags, diagnostic{Range: d.lineRange(1), Severity: severityError, Source: "hercode", Message: err.Error()})
+	}
+	for _, f := range found {
+		diag := diagnostic{
+			Range:   d.lineRange(f.Line),
+			Code:    f.Rule,
+			Source:  "hercode",
+			Message: f.Msg,
+		}
+		switch f.Severity {
+		case hercodeinterpreter.SeverityError:
+			diag.Severity = severityError
+		case hercodeinterpreter.SeverityWarning:
+			diag.Severity = severityWarning
+		default:
+			diag.Severity = severityInformation
+		}
+		switch f.Rule {
+		case hercodeinterpreter.RuleUnusedVariable, hercodeinterpreter.RuleUnusedParameter,
+			hercodeinterpreter.RuleUnreachable, hercodeinterpreter.RuleUnusedFunction:
+			diag.Tags = []int{tagUnnecessary}
+		}
+		diags = append(diags, diag)
+	}
+	return diags
+}
+
+// 一行（行号从 1 开始）中代码所在的范围，没有代码时是注释所在的范围
+func (d *document) lineRange(num int) textRange {
+	line := max(num-1, 0)
+	l, ok := d.source[num]
+	if !ok {
+		return textRange{Start: position{line, 0}, End: position{line, d.lineLength(line)}}
+	}
+	start := len(l.Indent)
+	end := start + len(l.Code)
+	if l.Code == "" {
+		start += len(l.Space)
+		end = start + len(l.Comment)
+	}
+	return d.byteRange(line, start, end)
+}
+
+// 名字在一行中第一次出现（不算字符串中的）的范围，找不到时是整行代码的范围
+func (d *document) nameRange(l *hercodeinterpreter.SourceLine, name string) textRange {
+	if i := findWord(l.Code, name); i >= 0 {
+		start := len(l.Indent) + i
+		return d.byteRange(l.Num-1, start, start+len(name))
+	}
+	return d.lineRange(l.Num)
+}
+
+// 一行中两个字节偏移之间的范围
+func (d *document) byteRange(line, start, end int) textRange {
+	text := d.line(line)
+	return textRange{
+		Start: position{line, utf16Len(text[:min(start, len(text))])},
+		End:   position{line, utf16Len(text[:min(end, len(text))])},
+	}
+}
+
+// 第 line 行（从 0 开始）的内容，不包括行末的 \r
+func (d *document) line(line int) string {
+	if line < 0 || line >= len(d.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(d.lines[line], "\r")
+}
+
+func (d *document) lineLength(line int) int {
+	return utf16Len(d.line(line))
+}
+
+// 光标所在的名字及其范围，光标不在名字上时返回空字符串
+func (d *document) wordAt(pos position) (string, textRange) {
+	text := d.line(pos.Line)
+	i := byteOffset(text, pos.Character)
+	start, end := i, i
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !isNameRune(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !isNameRune(r) {
+			break
+		}
+		end += size
+	}
+	if start == end || inString(text, start) {
+		return "", textRange{}
+	}
+	if l, ok := d.source[pos.Line+1]; ok && start >= len(l.Indent)+len(l.Code) {
+		return "", textRange{} // 在注释中
+	}
+	return text[start:end], d.byteRange(pos.Line, start, end)
+}
+
+// 光标所在的函数，不在函数中时为 nil。line 从 1 开始
+func (d *document) funcAt(line int) *hercodeinterpreter.Node {
+	for _, fn := range d.funcs {
+		if fn.Line.Num <= line && line <= fn.LastLine() {
+			return fn
+		}
+	}
+	return nil
+}
+
+// 按名字查找函数，包括 start
+func (d *document) function(name string) *hercodeinterpreter.Node {
+	for _, fn := range d.funcs {
+		if fn.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// 函数的参数，优先使用 Parse 得到的 HerCodeFunction
+func (d *document) params(fn *hercodeinterpreter.Node) []string {
+	if f, ok := d.h.GlobalCtx.Functions[fn.Name]; ok && f.Line == fn.Line.Num {
+		return f.Parameters
+	}
+	return fn.Params
+}
+
+// 变量在函数中第一次赋值的一行，没有赋值时为 nil
+func firstAssign(fn *hercodeinterpreter.Node, name string) *hercodeinterpreter.SourceLine {
+	var found *hercodeinterpreter.SourceLine
+	eachStmt(fn.Children, func(n *hercodeinterpreter.Node) {
+		if found == nil && assignedName(n.Stmt) == name {
+			found = n.Line
+		}
+	})
+	return found
+}
+
+// 函数中的参数和赋值过的变量
+func localNames(fn *hercodeinterpreter.Node) []string {
+	names := append([]string{}, fn.Params...)
+	eachStmt(fn.Children, func(n *hercodeinterpreter.Node) {
+		if name := assignedName(n.Stmt); name != "" {
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// 函数定义前面紧挨着的注释，去掉开头的 #
+func (d *document) docComment(fn *hercodeinterpreter.Node) string {
+	var lines []string
+	for num := fn.Line.Num - 1; num > 0; num-- {
+		l, ok := d.source[num]
+		if !ok || l.Code != "" || l.Comment == "" {
+			break
+		}
+		lines = append([]string{strings.TrimSpace(strings.TrimLeft(l.Comment, "#"))}, lines...)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// 按源代码的顺序遍历块中的语句节点，包括嵌套的块
+func eachStmt(nodes []*hercodeinterpreter.Node, visit func(n *hercodeinterpreter.Node)) {
+	for _, n := range nodes {
+		if n.Stmt != nil {
+			visit(n)
+		}
+		eachStmt(n.Children, visit)
+		eachStmt(n.ElseChildren, visit)
+	}
+}
+
+// 语句赋值的变量，不赋值时为空
+func assignedName(stmt hercodeinterpreter.Statement) string {
+	switch s := stmt.(type) {
+	case *hercodeinterpreter.VarDeclStmt:
+		return s.VarName
+	case *hercodeinterpreter.AssignStmt:
+		return s.VarName
+	case *hercodeinterpreter.AskStmt:
+		return s.VarName
+	}
+	return ""
+}
+
+// 名字可以包含的字符，与解释器相同：字母（包括中文）、数字和下划线
+func isNameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// 代码中第一个完整的、不在字符串中的 name 的字节偏移，找不到时返回 -1
+func findWord(code, name string) int {
+	quoted := false
+	for i := 0; i < len(code); {
+		r, size := utf8.DecodeRuneInString(code[i:])
+		switch {
+		case quoted && r == '\\':
+			size++
+		case r == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(code[i:], name):
+			before, _ := utf8.DecodeLastRuneInString(code[:i])
+			after, _ := utf8.DecodeRuneInString(code[i+len(name):])
+			if (i == 0 || !isNameRune(before)) && (i+len(name) == len(code) || !isNameRune(after)) {
+				return i
+			}
+		}
+		i += size
+	}
+	return -1
+}
+
+// 字节偏移 i 是否在字符串中
+func inString(text string, i int) bool {
+	quoted := false
+	for j := 0; j < i && j < len(text); j++ {
+		switch {
+		case quoted && text[j] == '\\':
+			j++
+		case text[j] == '"':
+			quoted = !quoted
+		}
+	}
+	return quoted
+}
+
+// 字符串的 UTF-16 长度
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// UTF-16 列号对应的字节偏移，超出一行时为行末
+func byteOffset(text string, col int) int {
+	n := 0
+	for i, r := range text {
+		if n >= col {
+			return i
+		}
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return len(text)
+}
@@ -0,0 +1,445 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+)
+
+// ==================== 语言服务器 ====================
+// hercode lsp 通过标准输入输出与编辑器通信（Language Server Protocol），提供：
+//   - 诊断：语法错误、未定义的名字和 lint 发现的问题，打开或修改文档时发送
+//   - 悬停：函数的签名和定义前面的注释、内置函数的签名、变量和参数的来历
+//   - 跳转到定义：函数、参数和变量
+//   - 补全：关键字（包括别名）、内置函数、内置常量、脚本中的函数和变量
+//   - 文档大纲：所有的函数和 start
+//   - 格式化：与 hercode fmt 相同
+//
+// 输入输出都是 io.Reader / io.Writer，测试时可以直接写入 JSON-RPC 消息，再从输出中读取回复和通知。
+
+// 语言服务器的设置
+type Config struct {
+	// 创建解释器，每次分析文档时调用。解释器只用来解析、检查和格式化，不会运行脚本
+	New func() *hercodeinterpreter.HerCodeInterpreter
+	In  io.Reader
+	Out io.Writer
+}
+
+// 收到 exit 通知之前没有收到 shutdown 请求
+var ErrNoShutdown = errors.New("lsp: exit before shutdown")
+
+type server struct {
+	cfg         Config
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+	err         error // 第一个写出错误
+}
+
+// 处理消息，直到收到 exit 通知或输入结束。exit 之前没有 shutdown 时返回 ErrNoShutdown
+func Run(cfg Config) error {
+	s := &server{cfg: cfg, docs: map[string]*document{}}
+	in := bufio.NewReader(cfg.In)
+	for s.err == nil {
+		body, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.send(errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &responseError{Code: codeParseError, Message: err.Error()}})
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+
+		result, rerr := s.dispatch(&req)
+		switch {
+		case req.isNotification():
+			// 通知不需要回复
+		case rerr != nil:
+			s.send(errorResponse{JSONRPC: "2.0", ID: req.ID, Error: rerr})
+		default:
+			s.send(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+	}
+	return s.err
+}
+
+// 写出一条消息，出错时记录下来，Run 随后结束
+func (s *server) send(v any) {
+	if s.err == nil {
+		s.err = writeMessage(s.cfg.Out, v)
+	}
+}
+
+func (s *server) dispatch(req *request) (any, *responseError) {
+	if req.Method == "initialize" {
+		s.initialized = true
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:           syncFull,
+				HoverProvider:              true,
+				DefinitionProvider:         true,
+				CompletionProvider:         map[string]any{},
+				DocumentSymbolProvider:     true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: map[string]string{"name": "hercode"},
+		}, nil
+	}
+	if !s.initialized {
+		return nil, &responseError{Code: codeNotInitialized, Message: "server not initialized"}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "invalid request"}
+	}
+
+	switch req.Method {
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := decode(req, &p); err != nil {
+			return nil, err
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := decode(req, &p); err != nil {
+			return nil, err
+		}
+		d, ok := s.docs[p.TextDocument.URI]
+		if !ok || len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := d.text
+		for _, change := range p.ContentChanges {
+			text = applyChange(text, change.Range, change.Text)
+		}
+		s.update(d.uri, text)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := decode(req, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.publish(p.TextDocument.URI, []diagnostic{})
+		return nil, nil
+
+	case "textDocument/hover":
+		return withPosition(s, req, (*document).hover)
+	case "textDocument/definition":
+		return withPosition(s, req, (*document).definition)
+	case "textDocument/completion":
+		return withPosition(s, req, (*document).completion)
+
+	case "textDocument/documentSymbol":
+		d, err := s.document(req)
+		if err != nil || d == nil {
+			return nil, err
+		}
+		return d.symbols(), nil
+
+	case "textDocument/formatting":
+		d, err := s.document(req)
+		if err != nil || d == nil {
+			return nil, err
+		}
+		return d.format(s.cfg.New())
+	}
+
+	if req.isNotification() {
+		return nil, nil // 不认识的通知，例如 initialized、$/cancelRequest，直接忽略
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func decode(req *request, v any) *responseError {
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// 请求中的文档，没有打开过的文档为 nil
+func (s *server) document(req *request) (*document, *responseError) {
+	var p documentParams
+	if err := decode(req, &p); err != nil {
+		return nil, err
+	}
+	return s.docs[p.TextDocument.URI], nil
+}
+
+// 处理以文档和光标位置为参数的请求，文档没有打开过时结果为 null
+func withPosition[T any](s *server, req *request, handle func(d *document, pos position) *T) (any, *responseError) {
+	var p textDocumentPositionParams
+	if err := decode(req, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	if result := handle(d, p.Position); result != nil {
+		return result, nil
+	}
+	return nil, nil
+}
+
+// 重新分析文档并发送诊断
+func (s *server) update(uri, text string) {
+	d := newDocument(uri, text, s.cfg.New())
+	s.docs[uri] = d
+	s.publish(uri, d.diagnostics())
+}
+
+func (s *server) publish(uri string, diags []diagnostic) {
+	s.send(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+// 把一处修改应用到文本上，没有范围时替换整个文本
+func applyChange(text string, r *textRange, newText string) string {
+	if r == nil {
+		return newText
+	}
+	offset := func(pos position) int {
+		i := 0
+		for line := 0; line < pos.Line; line++ {
+			next := strings.IndexByte(text[i:], '\n')
+			if next < 0 {
+				return len(text)
+			}
+			i += next + 1
+		}
+		end := strings.IndexByte(text[i:], '\n')
+		if end < 0 {
+			end = len(text) - i
+		}
+		return i + byteOffset(text[i:i+end], pos.Character)
+	}
+	start, end := offset(r.Start), offset(r.End)
+	if start > end {
+		return text
+	}
+	return text[:start] + newText + text[end:]
+}
+
+// ==================== 请求的处理 ====================
+
+// 悬停：用户函数显示签名和定义前面的注释，内置函数显示签名，变量和参数显示它们从哪里来
+func (d *document) hover(pos position) *hover {
+	word, r := d.wordAt(pos)
+	if word == "" || d.tree == nil {
+		return nil
+	}
+	t := texts(d.h)
+	var value string
+	switch {
+	case d.function(word) != nil && word != "start":
+		fn := d.function(word)
+		value = codeBlock(fmt.Sprintf("function %s(%s)", fn.Name, strings.Join(d.params(fn), ", "))) +
+			fmt.Sprintf(t.definedAt, fn.Line.Num)
+		if doc := d.docComment(fn); doc != "" {
+			value += "\n\n" + doc
+		}
+	case d.builtin(word) != nil:
+		value = codeBlock(d.builtin(word).SignatureIn(d.h.Lang())) + t.builtin
+	default:
+		fn := d.funcAt(pos.Line + 1)
+		if fn == nil {
+			return nil
+		}
+		for _, p := range fn.Params {
+			if p == word {
+				value = codeBlock(word) + fmt.Sprintf(t.param, fn.Name)
+			}
+		}
+		if value != "" {
+			break
+		}
+		if l := d.variable(fn, word); l != nil {
+			value = codeBlock("var "+word) + fmt.Sprintf(t.variable, l.Num)
+		} else if v, ok := hercodeinterpreter.Constants()[word]; ok {
+			value = codeBlock(word+" = "+v.String()) + t.constant
+		} else {
+			return nil
+		}
+	}
+	return &hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+func codeBlock(code string) string {
+	return "```hercode\n" + code + "\n```\n"
+}
+
+// 按名字或别名查找内置函数
+func (d *document) builtin(name string) *hercodeinterpreter.Builtin {
+	if real, ok := d.aliases[name]; ok {
+		name = real
+	}
+	return d.h.Builtins[name]
+}
+
+// 函数中可以使用的变量第一次赋值的一行：先找函数自己，再找 start（全局变量）
+func (d *document) variable(fn *hercodeinterpreter.Node, name string) *hercodeinterpreter.SourceLine {
+	if l := firstAssign(fn, name); l != nil {
+		return l
+	}
+	if start := d.function("start"); start != nil {
+		return firstAssign(start, name)
+	}
+	return nil
+}
+
+// 跳转到定义：函数跳到定义的一行，参数跳到函数定义，变量跳到第一次赋值的一行
+func (d *document) definition(pos position) *location {
+	word, _ := d.wordAt(pos)
+	if word == "" || d.tree == nil {
+		return nil
+	}
+	if fn := d.function(word); fn != nil {
+		return &location{URI: d.uri, Range: d.nameRange(fn.Line, word)}
+	}
+	fn := d.funcAt(pos.Line + 1)
+	if fn == nil {
+		return nil
+	}
+	for _, p := range fn.Params {
+		if p == word {
+			return &location{URI: d.uri, Range: d.nameRange(fn.Line, word)}
+		}
+	}
+	if l := d.variable(fn, word); l != nil {
+		return &location{URI: d.uri, Range: d.nameRange(l, word)}
+	}
+	return nil
+}
+
+// 补全：关键字和它们的别名、内置函数、内置常量、脚本中的函数，以及光标所在函数中可以使用的变量。
+// 由编辑器按已经输入的内容筛选
+func (d *document) completion(pos position) *completionList {
+	t := texts(d.h)
+	list := &completionList{Items: []completionItem{}}
+	seen := map[string]bool{}
+	add := func(label string, kind int, detail string) {
+		if label != "" && !seen[label] {
+			seen[label] = true
+			list.Items = append(list.Items, completionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+
+	for _, kw := range hercodeinterpreter.Keywords() {
+		add(kw, completionKeyword, t.keyword)
+	}
+	for _, pack := range d.h.LanguagePacks {
+		for _, kw := range sortedKeys(pack.Keywords) {
+			for _, alias := range pack.Keywords[kw] {
+				add(alias, completionKeyword, fmt.Sprintf(t.aliasOf, kw))
+			}
+		}
+	}
+
+	if fn := d.funcAt(pos.Line + 1); fn != nil {
+		for _, name := range localNames(fn) {
+			add(name, completionVariable, "")
+		}
+	}
+	if start := d.function("start"); start != nil {
+		for _, name := range localNames(start) {
+			add(name, completionVariable, "")
+		}
+	}
+	for _, fn := range d.funcs {
+		if fn.Kind == hercodeinterpreter.FuncNode {
+			add(fn.Name, completionFunction, fmt.Sprintf("%s(%s)", fn.Name, strings.Join(d.params(fn), ", ")))
+		}
+	}
+
+	for _, name := range sortedKeys(d.h.Builtins) {
+		add(name, completionFunction, d.h.Builtins[name].SignatureIn(d.h.Lang()))
+	}
+	for _, alias := range sortedKeys(d.aliases) {
+		if b := d.builtin(alias); b != nil {
+			add(alias, completionFunction, b.SignatureIn(d.h.Lang()))
+		}
+	}
+	constants := hercodeinterpreter.Constants()
+	for _, name := range sortedKeys(constants) {
+		add(name, completionConstant, constants[name].String())
+	}
+	return list
+}
+
+// 文档大纲：每个函数和 start 一项，范围从定义的一行到 end
+func (d *document) symbols() []documentSymbol {
+	symbols := []documentSymbol{}
+	for _, fn := range d.funcs {
+		if fn.Name == "" {
+			continue // 例如写错的“function :”，编辑器不接受没有名字的符号
+		}
+		full := d.lineRange(fn.Line.Num)
+		full.End = d.lineRange(fn.LastLine()).End
+		sym := documentSymbol{
+			Name:           fn.Name,
+			Kind:           symbolFunction,
+			Range:          full,
+			SelectionRange: d.nameRange(fn.Line, fn.Name),
+		}
+		if fn.Kind == hercodeinterpreter.FuncNode {
+			sym.Detail = "(" + strings.Join(d.params(fn), ", ") + ")"
+		} else {
+			// start 的写法可能是别名，例如“开始：”
+			sym.SelectionRange = d.lineRange(fn.Line.Num)
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols
+}
+
+// 格式化整个文档，已经格式化时没有修改。有语法错误时返回错误
+func (d *document) format(h *hercodeinterpreter.HerCodeInterpreter) (any, *responseError) {
+	out, err := h.Format(d.text)
+	if err != nil {
+		return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+	}
+	if out == d.text {
+		return []textEdit{}, nil
+	}
+	last := len(d.lines) - 1
+	end := position{last, utf16Len(d.lines[last])}
+	return []textEdit{{Range: textRange{End: end}, NewText: out}}, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,362 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+)
+
+const testURI = "file:///test.hc"
+
+const testScript = `# 打招呼
+function greet name:
+    say "hi " + name
+end
+
+start:
+    var who = "ann"
+    greet(who)
+  say nam
+end
+`
+
+// 服务器写出的一条消息：回复有 id，通知有 method
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+	Params json.RawMessage `json:"params"`
+}
+
+func call(id int, method string, params any) request {
+	req := notify(method, params)
+	req.ID, _ = json.Marshal(id)
+	return req
+}
+
+func notify(method string, params any) request {
+	req := request{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		req.Params, _ = json.Marshal(params)
+	}
+	return req
+}
+
+func docParams(uri string) documentParams {
+	return documentParams{TextDocument: textDocumentIdentifier{URI: uri}}
+}
+
+func posParams(line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: testURI}, Position: position{line, character}}
+}
+
+// 把消息交给 Run 处理，返回服务器写出的所有消息和 Run 的结果
+func session(t *testing.T, reqs ...request) ([]message, error) {
+	t.Helper()
+	return sessionWith(t, hercodeinterpreter.NewHerCodeInterpreter, reqs...)
+}
+
+// 与 session 相同，用 newInterp 创建解释器
+func sessionWith(t *testing.T, newInterp func(...hercodeinterpreter.Option) *hercodeinterpreter.HerCodeInterpreter, reqs ...request) ([]message, error) {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, req := range reqs {
+		if err := writeMessage(&in, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := Run(Config{
+		New: func() *hercodeinterpreter.HerCodeInterpreter { return newInterp() },
+		In:  &in,
+		Out: &out,
+	})
+	var msgs []message
+	r := bufio.NewReader(&out)
+	for {
+		body, rerr := readMessage(r)
+		if rerr == io.EOF {
+			return msgs, err
+		}
+		if rerr != nil {
+			t.Fatalf("reading server output: %v", rerr)
+		}
+		var m message
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatalf("server wrote %s: %v", body, err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+// id 为 id 的回复
+func reply(t *testing.T, msgs []message, id int) message {
+	t.Helper()
+	want, _ := json.Marshal(id)
+	for _, m := range msgs {
+		if bytes.Equal(m.ID, want) {
+			return m
+		}
+	}
+	t.Fatalf("no reply to request %d", id)
+	return message{}
+}
+
+// 所有 publishDiagnostics 通知，按发送的顺序
+func published(t *testing.T, msgs []message) []publishDiagnosticsParams {
+	t.Helper()
+	var all []publishDiagnosticsParams
+	for _, m := range msgs {
+		if m.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var p publishDiagnosticsParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, p)
+	}
+	return all
+}
+
+func result[T any](t *testing.T, m message) T {
+	t.Helper()
+	var v T
+	if m.Error != nil {
+		t.Fatalf("request %s failed: %v", m.ID, m.Error)
+	}
+	if err := json.Unmarshal(m.Result, &v); err != nil {
+		t.Fatalf("result %s: %v", m.Result, err)
+	}
+	return v
+}
+
+func TestFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMessage(&buf, call(1, "shutdown", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "Content-Length: 44\r\n\r\n{") {
+		t.Errorf("framed message = %q", buf.String())
+	}
+	r := bufio.NewReader(&buf)
+	body, err := readMessage(r)
+	if err != nil || string(body) != `{"jsonrpc":"2.0","id":1,"method":"shutdown"}` {
+		t.Errorf("readMessage = %q, %v", body, err)
+	}
+	if _, err := readMessage(r); err != io.EOF {
+		t.Errorf("readMessage at end of input = %v, want io.EOF", err)
+	}
+
+	for _, tc := range []struct {
+		input string
+		want  error
+	}{
+		{"Content-Length: 10\r\n\r\n{}", io.ErrUnexpectedEOF},
+		{"Content-Length: 2\r\n", io.ErrUnexpectedEOF},
+		{"Content-Type: x\r\n\r\n{}", nil},
+		{"Content-Length: -1\r\n\r\n", nil},
+		{"Content-Length: 999999999999999\r\n\r\n{}", nil},
+		{"Content-Length: 99999999999999999999999\r\n\r\n{}", nil},
+		{"no colon\r\n\r\n", nil},
+	} {
+		_, err := readMessage(bufio.NewReader(strings.NewReader(tc.input)))
+		if err == nil || tc.want != nil && err != tc.want {
+			t.Errorf("readMessage(%q) = %v, want %v", tc.input, err, tc.want)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	msgs, err := session(t,
+		call(1, "initialize", map[string]any{}),
+		notify("initialized", map[string]any{}),
+		notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: testURI, Version: 1, Text: testScript}}),
+		call(2, "textDocument/hover", posParams(7, 5)),
+		call(3, "textDocument/definition", posParams(7, 5)),
+		call(4, "textDocument/definition", posParams(7, 11)),
+		call(5, "textDocument/completion", posParams(8, 2)),
+		call(6, "textDocument/documentSymbol", docParams(testURI)),
+		call(7, "textDocument/formatting", docParams(testURI)),
+		call(8, "textDocument/hover", textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: "file:///other.hc"}}),
+		call(9, "workspace/symbol", map[string]any{}),
+		call(10, "shutdown", nil),
+		notify("exit", nil),
+	)
+	if err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+
+	caps := result[initializeResult](t, reply(t, msgs, 1)).Capabilities
+	if caps.TextDocumentSync != syncFull || !caps.HoverProvider || !caps.DocumentFormattingProvider {
+		t.Errorf("capabilities = %+v", caps)
+	}
+
+	diags := published(t, msgs)
+	if len(diags) != 1 || diags[0].URI != testURI {
+		t.Fatalf("published = %+v, want diagnostics for %s", diags, testURI)
+	}
+	if d := diags[0].Diagnostics; len(d) != 1 || d[0].Code != hercodeinterpreter.RuleNames ||
+		d[0].Severity != severityError || d[0].Range != (textRange{position{8, 2}, position{8, 9}}) {
+		t.Errorf("diagnostics = %+v, want the undefined nam on line 9", d)
+	}
+
+	h := result[hover](t, reply(t, msgs, 2))
+	if !strings.Contains(h.Contents.Value, "function greet(name)") || !strings.Contains(h.Contents.Value, "打招呼") {
+		t.Errorf("hover = %q, want the signature and the comment", h.Contents.Value)
+	}
+
+	for id, line := range map[int]int{3: 1, 4: 6} {
+		loc := result[location](t, reply(t, msgs, id))
+		if loc.URI != testURI || loc.Range.Start.Line != line {
+			t.Errorf("definition %d = %+v, want line %d", id, loc, line)
+		}
+	}
+
+	labels := map[string]bool{}
+	for _, item := range result[completionList](t, reply(t, msgs, 5)).Items {
+		labels[item.Label] = true
+	}
+	for _, want := range []string{"greet", "who", "say", "len", "true"} {
+		if !labels[want] {
+			t.Errorf("completion has no %q", want)
+		}
+	}
+	if labels["name"] {
+		t.Error("completion in start offers greet's parameter name")
+	}
+
+	var names []string
+	for _, sym := range result[[]documentSymbol](t, reply(t, msgs, 6)) {
+		names = append(names, sym.Name)
+	}
+	if strings.Join(names, " ") != "greet start" {
+		t.Errorf("symbols = %v, want [greet start]", names)
+	}
+
+	edits := result[[]textEdit](t, reply(t, msgs, 7))
+	if len(edits) != 1 || !strings.Contains(edits[0].NewText, "\n    say nam\n") || edits[0].Range.End.Line != 10 {
+		t.Errorf("formatting = %+v, want one edit replacing the whole document", edits)
+	}
+
+	if m := reply(t, msgs, 8); m.Error != nil || string(m.Result) != "null" {
+		t.Errorf("hover in a closed document = %s %v, want null", m.Result, m.Error)
+	}
+	if m := reply(t, msgs, 9); m.Error == nil || m.Error.Code != codeMethodNotFound {
+		t.Errorf("unknown method = %+v, want error %d", m.Error, codeMethodNotFound)
+	}
+	if m := reply(t, msgs, 10); m.Error != nil || string(m.Result) != "null" {
+		t.Errorf("shutdown = %s %v, want null", m.Result, m.Error)
+	}
+}
+
+// 语法错误的诊断不重复行号，写错的函数定义不出现在大纲中，修改和关闭文档时重新发送诊断
+func TestSyntaxErrors(t *testing.T) {
+	broken := "function :\nend\n\nstart:\n    say (\nend\n"
+	msgs, err := session(t,
+		call(1, "initialize", map[string]any{}),
+		notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: testURI, Text: "start:\nend\n"}}),
+		notify("textDocument/didChange", map[string]any{
+			"textDocument":   textDocumentIdentifier{URI: testURI},
+			"contentChanges": []map[string]any{{"text": broken}},
+		}),
+		call(2, "textDocument/documentSymbol", docParams(testURI)),
+		call(3, "textDocument/formatting", docParams(testURI)),
+		notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: testURI}}),
+		call(4, "shutdown", nil),
+		notify("exit", nil),
+	)
+	if err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+
+	diags := published(t, msgs)
+	if len(diags) != 3 || len(diags[0].Diagnostics) != 0 || len(diags[2].Diagnostics) != 0 {
+		t.Fatalf("published = %+v, want none, then the syntax errors, then none after closing", diags)
+	}
+	var lines []int
+	for _, d := range diags[1].Diagnostics {
+		if d.Code != hercodeinterpreter.RuleSyntax {
+			continue
+		}
+		lines = append(lines, d.Range.Start.Line)
+		if strings.HasPrefix(d.Message, "行") {
+			t.Errorf("diagnostic on line %d = %q, want no line number", d.Range.Start.Line+1, d.Message)
+		}
+	}
+	if len(lines) != 2 || lines[0] != 0 || lines[1] != 4 {
+		t.Errorf("syntax errors on lines %v, want [0 4]", lines)
+	}
+
+	symbols := result[[]documentSymbol](t, reply(t, msgs, 2))
+	if len(symbols) != 1 || symbols[0].Name != "start" {
+		t.Errorf("symbols = %+v, want only start", symbols)
+	}
+
+	m := reply(t, msgs, 3)
+	if m.Error == nil || m.Error.Code != codeRequestFailed || strings.Count(m.Error.Message, "行") != 1 {
+		t.Errorf("formatting = %+v, want one error naming the line once", m.Error)
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	msgs, err := session(t,
+		call(1, "textDocument/hover", posParams(0, 0)),
+		call(2, "initialize", map[string]any{}),
+		call(3, "shutdown", nil),
+	)
+	if err != nil {
+		t.Fatalf("Run = %v, want nil at the end of the input", err)
+	}
+	if m := reply(t, msgs, 1); m.Error == nil || m.Error.Code != codeNotInitialized {
+		t.Errorf("request before initialize = %+v, want error %d", m.Error, codeNotInitialized)
+	}
+	if m := reply(t, msgs, 3); m.Error != nil {
+		t.Errorf("shutdown after initialize = %v", m.Error)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	_, err := session(t,
+		call(1, "initialize", map[string]any{}),
+		notify("exit", nil),
+		call(2, "shutdown", nil),
+	)
+	if !errors.Is(err, ErrNoShutdown) {
+		t.Errorf("Run = %v, want ErrNoShutdown", err)
+	}
+}
+
+// 说明和诊断使用 Config.New 创建的解释器的语言，而不是进程的默认语言
+func TestLanguageFromInterpreter(t *testing.T) {
+	english := func(opts ...hercodeinterpreter.Option) *hercodeinterpreter.HerCodeInterpreter {
+		return hercodeinterpreter.NewHerCodeInterpreter(append(opts, hercodeinterpreter.WithLang(hercodeinterpreter.LangEN))...)
+	}
+	msgs, err := sessionWith(t, english,
+		call(1, "initialize", map[string]any{}),
+		notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: testURI, Text: "start:\n    say len(\"ab\")\n    say nam\nend\n"}}),
+		call(2, "textDocument/hover", posParams(1, 9)),
+		call(3, "shutdown", nil),
+	)
+	if err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	if hercodeinterpreter.CurrentLang() != hercodeinterpreter.LangZH {
+		t.Fatalf("default language = %s, want zh for this test", hercodeinterpreter.CurrentLang())
+	}
+
+	h := result[hover](t, reply(t, msgs, 2)).Contents.Value
+	if !strings.Contains(h, "built-in function") || !strings.Contains(h, "len(x string|list|dictionary)") {
+		t.Errorf("hover = %q, want an English description and signature", h)
+	}
+	diags := published(t, msgs)
+	if len(diags) != 1 || len(diags[0].Diagnostics) != 1 || !strings.HasPrefix(diags[0].Diagnostics[0].Message, "undefined variable") {
+		t.Errorf("published = %+v, want an English diagnostic", diags)
+	}
+}
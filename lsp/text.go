@@ -0,0 +1,37 @@
+package lsp
+
+import "github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+
+// 悬停和补全中显示的说明，与分析文档的解释器的错误信息使用同一种语言
+type text struct {
+	builtin, constant, keyword, aliasOf, function, definedAt, param, variable string
+}
+
+var textZH = text{
+	builtin:   "内置函数",
+	constant:  "内置常量",
+	keyword:   "关键字",
+	aliasOf:   "%s 的别名",
+	function:  "函数",
+	definedAt: "第 %d 行定义",
+	param:     "函数 %s 的参数",
+	variable:  "变量，第 %d 行第一次赋值",
+}
+
+var textEN = text{
+	builtin:   "built-in function",
+	constant:  "built-in constant",
+	keyword:   "keyword",
+	aliasOf:   "alias of %s",
+	function:  "function",
+	definedAt: "defined on line %d",
+	param:     "parameter of function %s",
+	variable:  "variable, first given a value on line %d",
+}
+
+func texts(h *hercodeinterpreter.HerCodeInterpreter) text {
+	if h.Lang() == hercodeinterpreter.LangEN {
+		return textEN
+	}
+	return textZH
+}
@@ -2,56 +2,168 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+
 	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
 	"github.com/playboy-Mr-Li/HerCode/itype"
-	"github.com/playboy-Mr-Li/HerCode/readfile"
 )
 
 var F itype.Flag
 
-func main() {
-	itype.PaseFlag(&F)
+// 退出码
+const (
+	exitOK      = 0
+	exitRuntime = 1 // 运行时错误、测试失败、fmt --check 发现没有格式化的文件，或 lint 发现错误或警告
+	exitUsage   = 2 // 命令行用法错误或无法读取文件，与 flag 包解析失败时的退出码相同
+	exitParse   = 3 // 语法错误或未定义的名字
+)
 
-	b, err := readfile.ReadFile(F.FileName)
-	if err != nil {
-		fmt.Printf("Error reading file: %v\n", err)
-	}
+// 命令行自己输出的提示信息
+type cliText struct {
+	readErr, parseErr, loadErr, runErr, compileErr, writeErr, isBytecode, built, bytecode string
+	noInput, noFile, testPass, testFail, testSummary, noTests, fmtStdin                   string
+	severity                                                                              map[hercodeinterpreter.Severity]string
+}
 
-	script := string(b)
+var cliTexts = map[hercodeinterpreter.Lang]cliText{
+	hercodeinterpreter.LangZH: {
+		readErr:     "读取文件错误: %v\n",
+		parseErr:    "解析错误: %v\n",
+		loadErr:     "载入错误: %v\n",
+		runErr:      "执行错误: %v\n",
+		compileErr:  "编译错误: %v\n",
+		writeErr:    "写入 %s 失败: %v\n",
+		isBytecode:  "%s 已经是字节码文件\n",
+		built:       "已生成 %s\n",
+		bytecode:    "字节码:",
+		noInput:     "hercode %s: 请指定脚本文件，或用 -e 给出代码\n",
+		noFile:      "hercode %s: 请指定脚本文件\n",
+		testPass:    "ok   %s %s\n",
+		testFail:    "FAIL %s %s\n     %v\n",
+		testSummary: "%d 个测试通过，%d 个失败\n",
+		noTests:     "没有找到测试文件（*_test.hc）",
+		fmtStdin:    "hercode fmt: --write 不能用于标准输入或 -e 给出的代码\n",
+		severity: map[hercodeinterpreter.Severity]string{
+			hercodeinterpreter.SeverityError:   "错误",
+			hercodeinterpreter.SeverityWarning: "警告",
+			hercodeinterpreter.SeverityInfo:    "提示",
+		},
+	},
+	hercodeinterpreter.LangEN: {
+		readErr:     "Error reading file: %v\n",
+		parseErr:    "Parse error: %v\n",
+		loadErr:     "Load error: %v\n",
+		runErr:      "Runtime error: %v\n",
+		compileErr:  "Compile error: %v\n",
+		writeErr:    "cannot write %s: %v\n",
+		isBytecode:  "%s is already a bytecode file\n",
+		built:       "wrote %s\n",
+		bytecode:    "Bytecode:",
+		noInput:     "hercode %s: no script file given, name one or use -e\n",
+		noFile:      "hercode %s: no script file given\n",
+		testPass:    "ok   %s %s\n",
+		testFail:    "FAIL %s %s\n     %v\n",
+		testSummary: "%d passed, %d failed\n",
+		noTests:     "no test files (*_test.hc)",
+		fmtStdin:    "hercode fmt: --write cannot be used with standard input or -e\n",
+		severity: map[hercodeinterpreter.Severity]string{
+			hercodeinterpreter.SeverityError:   "error",
+			hercodeinterpreter.SeverityWarning: "warning",
+			hercodeinterpreter.SeverityInfo:    "info",
+		},
+	},
+}
 
-	//fmt.Println(script)
+var text cliText
 
-	interpreter := hercodeinterpreter.NewHerCodeInterpreter()
+// 关键字语言包：方言文件中的别名与中文关键字同时可用
+var packs = []*hercodeinterpreter.LanguagePack{hercodeinterpreter.ChineseKeywords}
 
-	// 解析脚本
-	fmt.Println("Her Code is Compiling...")
-	if err := interpreter.Parse(script); err != nil {
-		fmt.Printf("解析错误: %v\n", err)
-		return
+func main() {
+	itype.PaseFlag(&F)
+
+	// 错误信息的语言：--lang 优先，其次是 LANG 环境变量，都不认识时用中文
+	lang, ok := hercodeinterpreter.ParseLang(F.Lang)
+	if !ok {
+		if F.Lang != "" {
+			fmt.Fprintf(os.Stderr, "unknown language %q, use zh or en\n", F.Lang)
+			os.Exit(exitUsage)
+		}
+		lang, _ = hercodeinterpreter.ParseLang(os.Getenv("LANG"))
 	}
-	if F.Debug {
-		fmt.Println("Her Code is Debugging...")
-		// 打印解析结果
-		interpreter.PrintFunctions()
+	hercodeinterpreter.SetLang(lang)
+	text = cliTexts[lang]
+
+	if F.SeedSet {
+		hercodeinterpreter.SeedRandom(F.Seed)
 	}
 
-	// 执行程序
-	fmt.Println("Her Code is Running...")
-	vals, errs := interpreter.Execute()
-	if len(errs) > 0 {
-		for _, err := range errs {
-			if err != nil {
-				fmt.Printf("执行错误: %v\n", err)
-			}
+	if F.Dialect != "" {
+		pack, err := hercodeinterpreter.LoadLanguagePack(F.Dialect)
+		if err == nil {
+			err = pack.Validate() // 命令行中只有默认的内置函数
 		}
-	}
-	if len(vals) > 0 {
-		for _, val := range vals {
-			if val.Error != nil {
-				fmt.Printf("执行错误: %v\n", val.Error)
-			}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, text.loadErr, fmt.Sprintf("%s: %v", F.Dialect, err))
+			os.Exit(exitUsage)
 		}
+		packs = append(packs, pack)
+	}
 
+	switch F.Command {
+	case "check":
+		os.Exit(check())
+	case "fmt":
+		os.Exit(format())
+	case "lint":
+		os.Exit(lint())
+	case "ast":
+		os.Exit(ast())
+	case "test":
+		os.Exit(test())
+	case "build":
+		os.Exit(build())
+	case "repl":
+		os.Exit(startRepl())
+	case "lsp":
+		os.Exit(serveLSP())
+	default:
+		os.Exit(run())
 	}
+}
+
+// 按命令行选项创建解释器
+func newInterpreter(stdin io.Reader) *hercodeinterpreter.HerCodeInterpreter {
+	return hercodeinterpreter.NewHerCodeInterpreter(
+		hercodeinterpreter.WithLanguagePacks(packs...),
+		hercodeinterpreter.WithStdout(os.Stdout),
+		hercodeinterpreter.WithStderr(os.Stderr),
+		hercodeinterpreter.WithStdin(stdin),
+		hercodeinterpreter.WithBeginnerMode(F.Beginner),
+		hercodeinterpreter.WithVM(F.VM),
+		hercodeinterpreter.WithArgs(F.Args...),
+		hercodeinterpreter.WithLimits(limits()),
+	)
+}
 
+// 命令行给出的资源限制，没有给出的项使用默认值
+func limits() hercodeinterpreter.Limits {
+	l := hercodeinterpreter.DefaultLimits
+	if F.Limits.MaxSteps > 0 {
+		l.MaxSteps = F.Limits.MaxSteps
+	}
+	if F.Limits.MaxCallDepth > 0 {
+		l.MaxCallDepth = F.Limits.MaxCallDepth
+	}
+	if F.Limits.MaxString > 0 {
+		l.MaxStringBytes = F.Limits.MaxString
+	}
+	if F.Limits.MaxCollection > 0 {
+		l.MaxCollectionSize = F.Limits.MaxCollection
+	}
+	if F.Limits.MaxOutput > 0 {
+		l.MaxOutputBytes = F.Limits.MaxOutput
+	}
+	return l
 }
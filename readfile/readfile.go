@@ -2,16 +2,39 @@ package readfile
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
+
+	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
 )
 
+// 读取 HerCode 源文件（.hc）或字节码文件（.hcb），字节码文件会检查格式版本和校验和。
+// 文件名为 - 时从标准输入读取源代码
 func ReadFile(fileName string) ([]byte, error) {
+	if fileName == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	if IsBytecode(fileName) {
+		b, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := hercodeinterpreter.CheckBytecode(b); err != nil {
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+		return b, nil
+	}
 
 	if !strings.HasSuffix(fileName, ".hc") {
-		return nil, fmt.Errorf("not a hercode file, must be .hc")
+		return nil, fmt.Errorf("not a hercode file, must be .hc or .hcb")
 
 	}
 
 	return os.ReadFile(fileName)
 }
+
+// 是否为字节码文件
+func IsBytecode(fileName string) bool {
+	return strings.HasSuffix(fileName, ".hcb")
+}
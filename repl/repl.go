@@ -0,0 +1,219 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+)
+
+// 交互式解释器：逐行读取代码并立即执行，函数、if、while 等多行结构读完整之后再执行。
+// 以 : 开头的是 REPL 命令，见 :help。
+
+// REPL 的设置
+type Config struct {
+	// 创建解释器，:reset 时重新调用。脚本中的 ask 和 input 应当从 stdin 读取输入，
+	// 它与 REPL 共用同一个缓冲，不会丢失已经读入缓冲的内容
+	New func(stdin io.Reader) *hercodeinterpreter.HerCodeInterpreter
+	In  io.Reader
+	Out io.Writer
+	// 历史记录文件，为空时只在内存中保留历史记录
+	HistoryFile string
+}
+
+type repl struct {
+	cfg     Config
+	in      *bufio.Reader
+	h       *hercodeinterpreter.HerCodeInterpreter
+	out     io.Writer
+	history []string
+	exit    *hercodeinterpreter.ExitError // 脚本调用了 exit
+}
+
+// 运行 REPL，直到输入结束或输入 :quit。代码中调用了 exit 时返回 *hercodeinterpreter.ExitError
+func Run(cfg Config) error {
+	r := &repl{cfg: cfg, in: bufio.NewReader(cfg.In), out: cfg.Out}
+	r.h = cfg.New(r.in)
+	r.loadHistory()
+	t := texts()
+	fmt.Fprintln(r.out, t.banner)
+
+	var buf []string
+	for {
+		if len(buf) == 0 {
+			fmt.Fprint(r.out, ">>> ")
+		} else {
+			fmt.Fprint(r.out, "... ")
+		}
+		line, err := r.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(r.out)
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if len(buf) == 0 {
+			cmd := strings.TrimSpace(line)
+			if cmd == "" {
+				continue
+			}
+			if strings.HasPrefix(cmd, ":") {
+				r.addHistory(cmd)
+				if quit := r.command(cmd); quit {
+					return nil
+				}
+				if r.exit != nil {
+					return r.exit
+				}
+				continue
+			}
+		}
+
+		buf = append(buf, line)
+		src := strings.Join(buf, "\n")
+		if r.h.Incomplete(src) {
+			continue
+		}
+		buf = nil
+		r.addHistory(src)
+		r.eval(src)
+		if r.exit != nil {
+			return r.exit
+		}
+	}
+}
+
+// 执行一段代码并输出表达式的值或错误
+func (r *repl) eval(src string) {
+	val, err := r.h.Eval(context.Background(), src)
+	if errors.As(err, &r.exit) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, texts().errorPrefix+err.Error())
+		return
+	}
+	if val.Type != hercodeinterpreter.VoidType {
+		fmt.Fprintln(r.out, val.String())
+	}
+}
+
+// 执行 REPL 命令，返回是否退出
+func (r *repl) command(cmd string) (quit bool) {
+	t := texts()
+	name, arg, _ := strings.Cut(cmd, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case ":help", ":h":
+		fmt.Fprintln(r.out, t.help)
+	case ":vars":
+		vars := r.h.GlobalCtx.Variables
+		for _, name := range sortedNames(vars) {
+			fmt.Fprintf(r.out, "%s = %s (%s)\n", name, vars[name], vars[name].Type)
+		}
+	case ":funcs":
+		funcs := r.h.GlobalCtx.Functions
+		for _, name := range sortedNames(funcs) {
+			if name == "start" {
+				continue
+			}
+			fmt.Fprintf(r.out, "function %s %s\n", name, strings.Join(funcs[name].Parameters, " "))
+		}
+	case ":reset":
+		r.h = r.cfg.New(r.in)
+		fmt.Fprintln(r.out, t.reset)
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(r.out, t.loadUsage)
+			break
+		}
+		b, err := os.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintln(r.out, t.errorPrefix+err.Error())
+			break
+		}
+		r.eval(string(b))
+	case ":history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(h, "\n", "\n      "))
+		}
+	case ":again", ":!":
+		// 重新执行第 n 条历史记录，不带参数时重新执行上一条代码
+		if src, ok := r.historyEntry(arg); ok {
+			fmt.Fprintln(r.out, src)
+			r.eval(src)
+		} else {
+			fmt.Fprintln(r.out, t.noHistory)
+		}
+	case ":quit", ":q", ":exit":
+		return true
+	default:
+		fmt.Fprintf(r.out, t.unknownCommand, name)
+	}
+	return false
+}
+
+// 第 n 条历史记录，n 为空时为最近一条不是命令的代码
+func (r *repl) historyEntry(n string) (string, bool) {
+	if n == "" {
+		for i := len(r.history) - 1; i >= 0; i-- {
+			if !strings.HasPrefix(r.history[i], ":") {
+				return r.history[i], true
+			}
+		}
+		return "", false
+	}
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(r.history) || strings.HasPrefix(r.history[i-1], ":") {
+		return "", false
+	}
+	return r.history[i-1], true
+}
+
+// 历史记录文件中每条记录占一行，多行代码中的换行保存为 \n
+func (r *repl) loadHistory() {
+	if r.cfg.HistoryFile == "" {
+		return
+	}
+	b, err := os.ReadFile(r.cfg.HistoryFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			r.history = append(r.history, strings.ReplaceAll(line, `\n`, "\n"))
+		}
+	}
+}
+
+func (r *repl) addHistory(entry string) {
+	r.history = append(r.history, entry)
+	if r.cfg.HistoryFile == "" {
+		return
+	}
+	f, err := os.OpenFile(r.cfg.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, strings.ReplaceAll(entry, "\n", `\n`))
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,57 @@
+package repl
+
+import "github.com/playboy-Mr-Li/HerCode/hercodeinterpreter"
+
+// REPL 的提示信息，与错误信息使用同一种语言
+type text struct {
+	banner, help, reset, loadUsage, noHistory, unknownCommand, errorPrefix string
+}
+
+var textZH = text{
+	banner: "HerCode 交互模式，输入 :help 查看帮助，:quit 退出",
+	help: `直接输入代码就会执行，输入表达式会显示它的值。
+function ... end、if ... endif、while ... endwhile 会在输入完整之后一起执行。
+
+命令:
+  :help          显示帮助
+  :vars          列出所有变量
+  :funcs         列出定义过的函数
+  :reset         清除所有变量和函数
+  :load 文件.hc  执行一个脚本文件，之后可以使用其中的函数和变量
+  :history       显示历史记录
+  :again [n]     重新执行第 n 条历史记录，不写 n 时重新执行上一条
+  :quit          退出`,
+	reset:          "已清除所有变量和函数",
+	loadUsage:      "用法: :load 文件.hc",
+	noHistory:      "没有这条历史记录",
+	unknownCommand: "未知的命令 %s，输入 :help 查看帮助\n",
+	errorPrefix:    "错误: ",
+}
+
+var textEN = text{
+	banner: "HerCode interactive mode, type :help for help, :quit to exit",
+	help: `Type code to run it; type an expression to see its value.
+function ... end, if ... endif and while ... endwhile run once they are complete.
+
+Commands:
+  :help          show this help
+  :vars          list all variables
+  :funcs         list defined functions
+  :reset         clear all variables and functions
+  :load file.hc  run a script file, then use its functions and variables
+  :history       show the history
+  :again [n]     run history entry n again, or the last one without n
+  :quit          exit`,
+	reset:          "all variables and functions cleared",
+	loadUsage:      "usage: :load file.hc",
+	noHistory:      "no such history entry",
+	unknownCommand: "unknown command %s, type :help for help\n",
+	errorPrefix:    "error: ",
+}
+
+func texts() text {
+	if hercodeinterpreter.CurrentLang() == hercodeinterpreter.LangEN {
+		return textEN
+	}
+	return textZH
+}